@@ -0,0 +1,204 @@
+package sail
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutputMode 备份目录的写入方式
+type OutputMode int
+
+const (
+	// OutputFiles 逐个文件原子写入（默认）
+	OutputFiles OutputMode = iota
+	// OutputAtomicDir 与 kubelet 挂载 ConfigMap 的方式一致，适用于 sidecar 模式：
+	// 每次把所有文件写入一个新的时间戳目录，再原子地切换 ..data 软链接
+	// ConfigFilePath/
+	//   ..2022_10_17_11_36_49.123456/  所有文件的快照
+	//   ..data -> ..2022_10_17_11_36_49.123456
+	//   mysql.toml -> ..data/mysql.toml
+	OutputAtomicDir
+)
+
+// DataDirName 指向当前快照目录的软链接
+const DataDirName = "..data"
+
+const (
+	dataDirTempName   = "..data_tmp"
+	snapshotDirPrefix = ".."
+	snapshotTimeFmt   = "2006_01_02_15_04_05."
+)
+
+func (m OutputMode) String() string {
+	if m == OutputAtomicDir {
+		return "atomic_dir"
+	}
+	return "files"
+}
+
+func parseOutputMode(mode string) (OutputMode, error) {
+	switch mode {
+	case "", "files":
+		return OutputFiles, nil
+	case "atomic_dir":
+		return OutputAtomicDir, nil
+	default:
+		return OutputFiles, fmt.Errorf("output mode should be files or atomic_dir, got %q ", mode)
+	}
+}
+
+// WithOutputMode 备份目录的写入方式，默认 OutputFiles
+func WithOutputMode(mode OutputMode) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.OutputMode = mode.String()
+	})
+}
+
+// snapshotFiles 当前所有需要写入备份目录的文件及其 revision
+func (f *FileMaintainer) snapshotFiles() (map[string][]byte, map[string]int64, error) {
+	if f.sail.metaConfig.MergeConfig {
+		mergeViper, err := f.mergeBackupVipers()
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := encodeViper(MergeConfigName, mergeViper)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encode config file %s err: %w ", MergeConfigName, err)
+		}
+		return map[string][]byte{MergeConfigName: content}, map[string]int64{MergeConfigName: f.sail.loadRevision()}, nil
+	}
+
+	f.sail.lock.RLock()
+	defer f.sail.lock.RUnlock()
+
+	files := make(map[string][]byte, len(f.sail.vipers))
+	revisions := make(map[string]int64, len(f.sail.vipers))
+	for k, v := range f.sail.vipers {
+		if f.skipBackup(k) {
+			continue
+		}
+		content, err := f.configFileContent(k, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[k] = content
+		revisions[k] = f.sail.revisions[k]
+	}
+	return files, revisions, nil
+}
+
+// writeSnapshot 写入完整的快照并切换 ..data，应用只会看到全部旧文件或全部新文件
+func (f *FileMaintainer) writeSnapshot() error {
+	files, revisions, err := f.snapshotFiles()
+	if err != nil {
+		return err
+	}
+
+	f.snapshotLock.Lock()
+	defer f.snapshotLock.Unlock()
+
+	dir := f.sail.metaConfig.ConfigFilePath
+	snapshotDir, err := os.MkdirTemp(dir, snapshotDirPrefix+time.Now().Format(snapshotTimeFmt))
+	if err != nil {
+		return fmt.Errorf("create snapshot dir err: %w ", err)
+	}
+	snapshotName := filepath.Base(snapshotDir)
+
+	manifest := &Manifest{Files: make(map[string]*ManifestEntry, len(files))}
+	for name, content := range files {
+		content, err := f.encodeBackup(name, content)
+		if err != nil {
+			_ = os.RemoveAll(snapshotDir)
+			return err
+		}
+		if err := atomicWriteFile(filepath.Join(snapshotDir, name), content, backupFilePerm); err != nil {
+			_ = os.RemoveAll(snapshotDir)
+			return fmt.Errorf("write config file %s err: %w ", name, err)
+		}
+		manifest.Files[name] = &ManifestEntry{
+			Revision:  revisions[name],
+			SHA256:    checksum(content),
+			WrittenAt: time.Now(),
+		}
+	}
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = atomicWriteFile(filepath.Join(snapshotDir, ManifestFileName), manifestContent, backupFilePerm)
+	}
+	if err != nil {
+		_ = os.RemoveAll(snapshotDir)
+		return fmt.Errorf("write manifest err: %w ", err)
+	}
+
+	// 切换 ..data，rename 是原子的
+	if err := replaceSymlink(snapshotName, filepath.Join(dir, dataDirTempName), filepath.Join(dir, DataDirName)); err != nil {
+		_ = os.RemoveAll(snapshotDir)
+		return fmt.Errorf("switch %s err: %w ", DataDirName, err)
+	}
+	f.manifestLock.Lock()
+	f.manifest = manifest
+	f.manifestLock.Unlock()
+
+	// 对外可见的文件都指向 ..data，新增的文件在切换后才出现
+	visible := map[string]bool{ManifestFileName: true}
+	for name := range files {
+		visible[name] = true
+	}
+	for name := range visible {
+		target := filepath.Join(DataDirName, name)
+		link := filepath.Join(dir, name)
+		if current, err := os.Readlink(link); err == nil && current == target {
+			continue
+		}
+		if err := replaceSymlink(target, filepath.Join(dir, tempFilePrefix+name), link); err != nil {
+			return fmt.Errorf("link config file %s err: %w ", name, err)
+		}
+	}
+
+	f.cleanSnapshots(snapshotName, visible)
+	return nil
+}
+
+// replaceSymlink 先在 tmp 创建软链接，再 rename 覆盖 link
+func replaceSymlink(target, tmp, link string) error {
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(link))
+}
+
+// cleanSnapshots 删除旧的快照目录，以及已经不存在的配置文件
+func (f *FileMaintainer) cleanSnapshots(current string, visible map[string]bool) {
+	dir := f.sail.metaConfig.ConfigFilePath
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		f.sail.l.Warn("read config file path fail. ", "err", err)
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case name == DataDirName || name == current || visible[name]:
+			continue
+		case strings.HasPrefix(name, snapshotDirPrefix) && e.IsDir():
+			err = os.RemoveAll(filepath.Join(dir, name))
+		case !isInternalFile(name):
+			err = os.Remove(filepath.Join(dir, name))
+		default:
+			continue
+		}
+		if err != nil {
+			// 没删掉，也不影响正常运行
+			f.sail.l.Warn("can't delete file. ", "config_file", name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package sail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseOutputMode(t *testing.T) {
+	for _, mode := range []OutputMode{OutputFiles, OutputAtomicDir} {
+		got, err := parseOutputMode(mode.String())
+		require.NoError(t, err)
+		assert.Equal(t, mode, got)
+	}
+	_, err := parseOutputMode("symlink")
+	assert.Error(t, err)
+
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+		OutputMode:    "symlink",
+	})
+	assert.Error(t, sail.Err())
+}
+
+func TestFileMaintainer_writeSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+	rev := src.Put("/conf/test_project_key/test/redis.toml", "host=\"0.0.0.0\"")
+
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml,redis.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src), WithOutputMode(OutputAtomicDir))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.Pull())
+
+	snapshot, err := os.Readlink(filepath.Join(dir, DataDirName))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(snapshot, snapshotDirPrefix))
+
+	for _, name := range []string{"mysql.toml", "redis.toml", ManifestFileName} {
+		target, err := os.Readlink(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, filepath.Join(DataDirName, name), target)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "redis.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "host=\"0.0.0.0\"", string(content))
+
+	manifest, err := ReadManifest(dir)
+	require.NoError(t, err)
+	require.Contains(t, manifest.Files, "redis.toml")
+	assert.Equal(t, rev, manifest.Files["redis.toml"].Revision)
+
+	// 更新后切换到新快照，旧快照被清理
+	src.Put("/conf/test_project_key/test/redis.toml", "host=\"127.0.0.1\"")
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(dir, "redis.toml"))
+		return err == nil && string(content) == "host=\"127.0.0.1\""
+	}, time.Second, 10*time.Millisecond)
+	_, err = os.Stat(filepath.Join(dir, snapshot))
+	assert.True(t, os.IsNotExist(err))
+
+	// 删除的配置不再可见
+	src.Delete("/conf/test_project_key/test/mysql.toml")
+	assert.Eventually(t, func() bool {
+		_, err := os.Lstat(filepath.Join(dir, "mysql.toml"))
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("ReadLocal", func(t *testing.T) {
+		local := New(&MetaConfig{
+			ETCDEndpoints:  "127.0.0.1:2379",
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "mysql.toml,redis.toml",
+			ConfigFilePath: dir,
+			OutputMode:     OutputAtomicDir.String(),
+		})
+		require.NoError(t, local.Err())
+		require.NoError(t, local.readLocalFileConfig())
+
+		assert.Equal(t, "127.0.0.1", local.MustGetString("host"))
+		assert.Nil(t, local.MustGet("database"))
+	})
+}
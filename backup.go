@@ -0,0 +1,142 @@
+package sail
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+// BackupMode 本地备份文件的写入方式
+type BackupMode int
+
+const (
+	// BackupPlain 明文写入（默认）
+	BackupPlain BackupMode = iota
+	// BackupEncrypt 用 BackupKey 加密后写入，未设置 BackupKey 时使用命名空间密钥
+	BackupEncrypt
+	// BackupMemory 加密过的配置（整个文件或字段加密）只保存在内存中，不写入备份
+	BackupMemory
+)
+
+// BackupKeyID MetaConfig.BackupKey 在密钥环中的 ID
+const BackupKeyID = "backup"
+
+const backupFilePerm = 0644
+
+func (m BackupMode) String() string {
+	switch m {
+	case BackupEncrypt:
+		return "encrypt"
+	case BackupMemory:
+		return "memory"
+	default:
+		return "plain"
+	}
+}
+
+func parseBackupMode(mode string) (BackupMode, error) {
+	switch mode {
+	case "", "plain":
+		return BackupPlain, nil
+	case "encrypt":
+		return BackupEncrypt, nil
+	case "memory":
+		return BackupMemory, nil
+	default:
+		return BackupPlain, fmt.Errorf("backup mode should be plain, encrypt or memory, got %q ", mode)
+	}
+}
+
+// WithBackupMode 本地备份文件的写入方式，默认 BackupPlain
+func WithBackupMode(mode BackupMode) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.BackupMode = mode.String()
+	})
+}
+
+// WithBackupKey 加密本地备份文件的密钥，只在本机使用，不需要和命名空间密钥一致
+func WithBackupKey(key string) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.BackupKey = key
+	})
+}
+
+// backupKey 加密备份文件所用的密钥
+func (s *Sail) backupKey() (NamespaceKey, bool) {
+	if len(s.metaConfig.BackupKey) > 0 {
+		return NamespaceKey{ID: BackupKeyID, Key: s.metaConfig.BackupKey}, true
+	}
+	keys := s.keyring()
+	if len(keys) == 0 {
+		return NamespaceKey{}, false
+	}
+	return keys[0], true
+}
+
+// isSecretConfig 配置是否经过了解密
+func (s *Sail) isSecretConfig(configFileKey string) bool {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+	return len(s.keyUsage[configFileKey]) > 0
+}
+
+// encodeViper 把 viper 中的配置按文件类型序列化
+func encodeViper(fileName string, v *viper.Viper) ([]byte, error) {
+	if strings.TrimPrefix(filepath.Ext(fileName), ".") == "custom" {
+		return []byte(v.GetString(fileName)), nil
+	}
+
+	fs := afero.NewMemMapFs()
+	w := viper.New()
+	w.SetFs(fs)
+	if err := w.MergeConfigMap(v.AllSettings()); err != nil {
+		return nil, err
+	}
+	memFile := "/" + filepath.Base(fileName)
+	if err := w.WriteConfigAs(memFile); err != nil {
+		return nil, err
+	}
+	return afero.ReadFile(fs, memFile)
+}
+
+// encodeBackup 写入磁盘的内容，BackupEncrypt 时加密
+func (f *FileMaintainer) encodeBackup(fileName string, content []byte) ([]byte, error) {
+	if f.sail.backupMode != BackupEncrypt {
+		return content, nil
+	}
+	key, ok := f.sail.backupKey()
+	if !ok {
+		// 宁可不写，也不能写明文
+		return nil, fmt.Errorf("encrypt config file %s err: %w ", fileName, ErrNamespaceKeyMissing)
+	}
+	encrypted, err := EncryptConfigContentWithKey(string(content), key)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt config file %s err: %w ", fileName, err)
+	}
+	return []byte(encrypted), nil
+}
+
+// writeConfigFile 原子地写入备份文件并更新清单，BackupEncrypt 时加密后写入
+func (f *FileMaintainer) writeConfigFile(fileName string, content []byte, revision int64) error {
+	content, err := f.encodeBackup(fileName, content)
+	if err != nil {
+		return err
+	}
+	entry := &ManifestEntry{
+		Revision:  revision,
+		SHA256:    checksum(content),
+		WrittenAt: time.Now(),
+	}
+	if err := f.markPending(fileName, entry); err != nil {
+		return err
+	}
+	err = atomicWriteFile(filepath.Join(f.sail.metaConfig.ConfigFilePath, fileName), content, backupFilePerm)
+	if err != nil {
+		return fmt.Errorf("write config file %s err: %w ", fileName, err)
+	}
+	return f.updateManifest(fileName, entry)
+}
@@ -0,0 +1,142 @@
+package sail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackupTestSail(t *testing.T, dir string, opts ...Option) *Sail {
+	encrypted, err := EncryptConfigContent("password=\"p@ss\"", testNamespaceKey)
+	require.NoError(t, err)
+
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", encrypted)
+	src.Put("/conf/test_project_key/test/app.toml", "name=\"app\"")
+
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		NamespaceKey:   testNamespaceKey,
+		Configs:        "app.toml,mysql.toml",
+		ConfigFilePath: dir,
+	}, append([]Option{WithSource(src)}, opts...)...)
+	require.NoError(t, sail.Err())
+	t.Cleanup(func() {
+		_ = sail.Close()
+	})
+	require.NoError(t, sail.Pull())
+	return sail
+}
+
+func TestFileMaintainer_backupMode(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) {
+		dir := t.TempDir()
+		newBackupTestSail(t, dir)
+
+		content, err := os.ReadFile(filepath.Join(dir, "mysql.toml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "p@ss")
+	})
+
+	t.Run("EncryptWithBackupKey", func(t *testing.T) {
+		dir := t.TempDir()
+		newBackupTestSail(t, dir, WithBackupMode(BackupEncrypt), WithBackupKey("LOCAL_BACKUP_KEY"))
+
+		for _, e := range []string{"mysql.toml", "app.toml"} {
+			content, err := os.ReadFile(filepath.Join(dir, e))
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(content), "SAILENC:v2:aes-256-gcm:backup:"), e)
+			assert.NotContains(t, string(content), "p@ss")
+		}
+
+		// 只有备份密钥也能读回
+		local := New(&MetaConfig{
+			ETCDEndpoints:  "127.0.0.1:2379",
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "app.toml,mysql.toml",
+			ConfigFilePath: dir,
+			BackupKey:      "LOCAL_BACKUP_KEY",
+		})
+		require.NoError(t, local.Err())
+		require.NoError(t, local.readLocalFileConfig())
+		assert.Equal(t, "p@ss", local.MustGetString("password"))
+		assert.Equal(t, "app", local.MustGetString("name"))
+	})
+
+	t.Run("EncryptWithNamespaceKey", func(t *testing.T) {
+		dir := t.TempDir()
+		newBackupTestSail(t, dir, WithBackupMode(BackupEncrypt))
+
+		content, err := os.ReadFile(filepath.Join(dir, "mysql.toml"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "SAILENC:v2:aes-256-gcm:default:"))
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		dir := t.TempDir()
+		// 之前写入的明文备份会被删除
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("password=\"p@ss\""), 0644))
+		sail := newBackupTestSail(t, dir, WithBackupMode(BackupMemory))
+
+		assert.Equal(t, "p@ss", sail.MustGetString("password"))
+		_, err := os.Stat(filepath.Join(dir, "mysql.toml"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(dir, "app.toml"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("MemoryMerge", func(t *testing.T) {
+		dir := t.TempDir()
+		newBackupTestSail(t, dir, WithBackupMode(BackupMemory), WithMergeConfig(true))
+
+		content, err := os.ReadFile(filepath.Join(dir, MergeConfigName))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "app")
+		assert.NotContains(t, string(content), "p@ss")
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		sail := New(&MetaConfig{
+			ETCDEndpoints: "127.0.0.1:2379",
+			ProjectKey:    "test_project_key",
+			Namespace:     "test",
+			BackupMode:    "zip",
+		})
+		assert.Error(t, sail.Err())
+	})
+}
+
+func TestSail_backupModeEncryptNeedsKey(t *testing.T) {
+	meta := func() *MetaConfig {
+		return &MetaConfig{
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "app.toml",
+			ConfigFilePath: t.TempDir(),
+			BackupMode:     "encrypt",
+		}
+	}
+
+	sail := New(meta(), WithSource(NewMemorySource()))
+	assert.Error(t, sail.Err())
+
+	withBackupKey := meta()
+	withBackupKey.BackupKey = "LOCAL_BACKUP_KEY"
+	for name, s := range map[string]*Sail{
+		"BackupKey":   New(withBackupKey, WithSource(NewMemorySource())),
+		"OptionKeys":  New(meta(), WithSource(NewMemorySource()), WithNamespaceKeys(NamespaceKey{ID: "k1", Key: testNamespaceKey})),
+		"KeyProvider": New(meta(), WithSource(NewMemorySource()), WithKeyProvider(NewEnvKeyProvider("SAIL_TEST_KEY"))),
+	} {
+		assert.NoError(t, s.Err(), name)
+		_ = s.Close()
+	}
+}
@@ -0,0 +1,202 @@
+package sail
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BackupError 后台写入备份文件失败，可以用 errors.As 获取
+type BackupError struct {
+	ConfigFileKey string
+	Err           error
+}
+
+func (e *BackupError) Error() string {
+	return fmt.Sprintf("write backup %s fail: %v ", e.ConfigFileKey, e.Err)
+}
+
+func (e *BackupError) Unwrap() error {
+	return e.Err
+}
+
+// backupWriter 唯一的后台写入协程，按变更顺序写入备份文件
+// 同一个文件排队中的多次变更只写一次，写入时读取内存中最新的配置，磁盘上的配置不会比先写入的更旧
+type backupWriter struct {
+	lock    sync.Mutex
+	queue   []string
+	pending map[string]struct{}
+	errs    map[string]*BackupError
+	closed  bool
+
+	notify    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newBackupWriter() *backupWriter {
+	return &backupWriter{
+		pending: make(map[string]struct{}),
+		errs:    make(map[string]*BackupError),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// BackupErrors 当前写入失败的备份文件，下一次写入成功后移除
+func (s *Sail) BackupErrors() map[string]*BackupError {
+	w := s.fm.writer
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	result := make(map[string]*BackupError, len(w.errs))
+	for k, v := range w.errs {
+		result[k] = v
+	}
+	return result
+}
+
+// queueKey 合并模式和快照模式下所有变更都会重写同一份输出，合并为一个任务
+func (f *FileMaintainer) queueKey(configFileKey string) string {
+	switch {
+	case f.sail.outputMode == OutputAtomicDir:
+		return DataDirName
+	case f.sail.metaConfig.MergeConfig:
+		return MergeConfigName
+	default:
+		return configFileKey
+	}
+}
+
+// enqueueWrite 把备份文件加入写入队列，已经在队列中的只保留一次
+func (f *FileMaintainer) enqueueWrite(configFileKey string) {
+	if len(f.sail.metaConfig.ConfigFilePath) == 0 {
+		return
+	}
+	f.startWriter.Do(func() {
+		go f.runWriter()
+	})
+
+	keys := []string{f.queueKey(configFileKey)}
+	if f.sail.metaConfig.HistoryLimit > 0 {
+		keys = append(keys, filepath.Join(HistoryDirName, configFileKey))
+	}
+
+	w := f.writer
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		f.sail.l.Warn("sail was closed, drop the backup write. ", "config_file", configFileKey)
+		return
+	}
+	for _, key := range keys {
+		if _, ok := w.pending[key]; !ok {
+			w.pending[key] = struct{}{}
+			w.queue = append(w.queue, key)
+		}
+	}
+	w.lock.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (f *FileMaintainer) runWriter() {
+	w := f.writer
+	defer close(w.done)
+	for {
+		w.lock.Lock()
+		if len(w.queue) == 0 {
+			closed := w.closed
+			w.lock.Unlock()
+			if closed {
+				return
+			}
+			<-w.notify
+			continue
+		}
+		key := w.queue[0]
+		w.queue = w.queue[1:]
+		// 先出队，写入期间的新变更会重新排队
+		delete(w.pending, key)
+		w.lock.Unlock()
+
+		f.writeBackup(key)
+	}
+}
+
+// writeBackup 写入单个任务，失败时记录到 BackupErrors 并回调 OnError
+func (f *FileMaintainer) writeBackup(key string) {
+	f.writeLock.Lock()
+	err := f.writeQueued(key)
+	f.writeLock.Unlock()
+
+	w := f.writer
+	w.lock.Lock()
+	if err == nil {
+		delete(w.errs, key)
+		w.lock.Unlock()
+		return
+	}
+	berr := &BackupError{ConfigFileKey: key, Err: err}
+	w.errs[key] = berr
+	w.lock.Unlock()
+
+	f.sail.l.Error("refresh config file fail. ", "config_file", key, "err", err)
+	f.sail.reportError(berr)
+}
+
+func (f *FileMaintainer) writeQueued(key string) error {
+	switch {
+	case strings.HasPrefix(key, HistoryDirName+string(filepath.Separator)):
+		return f.writeHistory(strings.TrimPrefix(key, HistoryDirName+string(filepath.Separator)))
+	case f.sail.outputMode == OutputAtomicDir:
+		return f.writeSnapshot()
+	case f.sail.metaConfig.MergeConfig:
+		mergeViper, err := f.mergeBackupVipers()
+		if err != nil {
+			return err
+		}
+		return f.writeMergeConfigFile(mergeViper, f.sail.loadRevision())
+	}
+
+	f.sail.lock.RLock()
+	defer f.sail.lock.RUnlock()
+
+	v, ok := f.sail.vipers[key]
+	if !ok || f.skipBackup(key) {
+		// 配置已被删除，或不允许写入备份
+		return f.removeConfigFile(key)
+	}
+	content, err := f.configFileContent(key, v)
+	if err != nil {
+		return err
+	}
+	return f.writeConfigFile(key, content, f.sail.revisions[key])
+}
+
+// closeWriter 写完队列中剩余的备份文件后退出，之后的变更不再写入
+func (f *FileMaintainer) closeWriter() {
+	w := f.writer
+	w.closeOnce.Do(func() {
+		w.lock.Lock()
+		w.closed = true
+		w.lock.Unlock()
+
+		started := true
+		f.startWriter.Do(func() {
+			started = false
+		})
+		if !started {
+			return
+		}
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+		<-w.done
+	})
+}
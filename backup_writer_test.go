@@ -0,0 +1,95 @@
+package sail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMaintainer_backupWriter(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=0")
+
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	require.NoError(t, sail.Pull())
+
+	var last int64
+	for i := 1; i <= 50; i++ {
+		last = src.Put("/conf/test_project_key/test/mysql.toml", fmt.Sprintf("version=%d", i))
+	}
+	assert.Eventually(t, func() bool {
+		return sail.MustGetInt("version") == 50
+	}, time.Second, 10*time.Millisecond)
+
+	// Close 会写完排队中的备份
+	require.NoError(t, sail.Close())
+	content, err := os.ReadFile(filepath.Join(dir, "mysql.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "version=50", string(content))
+	manifest, err := ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, last, manifest.Files["mysql.toml"].Revision)
+	assert.Empty(t, sail.BackupErrors())
+}
+
+func TestFileMaintainer_backupWriterError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conf")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=0")
+
+	var mu sync.Mutex
+	var reported []error
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src), WithOnError(func(err error, s *Sail) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.Pull())
+
+	// 备份目录不可写
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.WriteFile(dir, nil, 0644))
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=1")
+
+	assert.Eventually(t, func() bool {
+		return len(sail.BackupErrors()) == 1
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	require.Len(t, reported, 1)
+	var berr *BackupError
+	require.True(t, errors.As(reported[0], &berr))
+	mu.Unlock()
+	assert.Equal(t, "mysql.toml", berr.ConfigFileKey)
+
+	// 恢复后再次写入成功，错误被清除
+	require.NoError(t, os.Remove(dir))
+	require.NoError(t, os.Mkdir(dir, 0755))
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=2")
+	assert.Eventually(t, func() bool {
+		return len(sail.BackupErrors()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,186 @@
+package sail
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrBindTarget = errors.New("ErrBindTarget")
+)
+
+// Binding 配置文件与结构体的绑定
+// 每次配置变更都会解码出一份新的结构体并原子替换，读取方无需加锁。
+type Binding struct {
+	configFileKey string
+	typ           reflect.Type
+	template      reflect.Value
+
+	value atomic.Value
+	mu    sync.Mutex
+	err   error
+}
+
+// Load 获取当前的结构体，返回值与 Bind 时传入的指针类型一致。
+// 返回的结构体是只读快照，不要修改它。
+// 例：
+// b, _ := s.Bind("mysql.toml", &MySQLConf{})
+// conf := b.Load().(*MySQLConf)
+func (b *Binding) Load() interface{} {
+	return b.value.Load()
+}
+
+// Err 最近一次解码失败的错误，解码成功后会被清空。
+func (b *Binding) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *Binding) setErr(err error) {
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
+
+// newValue 以 Bind 时传入的结构体为默认值，深复制出一个新的实例
+// mapstructure 会解码到已有的 map 中，共用 map、slice 会修改模板和已经发布的快照
+func (b *Binding) newValue() reflect.Value {
+	ptr := reflect.New(b.typ)
+	ptr.Elem().Set(deepCopy(b.template))
+	return ptr
+}
+
+// deepCopy 复制指针、map、slice 指向的值，未导出的字段只做浅复制
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// Bind 把配置文件解码到结构体，并在配置变更时自动更新
+// ptr 必须是结构体指针，它的字段值会作为默认值。
+// 在 Pull 之前调用，会在 Pull 时解码；在 Pull 之后调用，会立即解码。
+func (s *Sail) Bind(configFileKey string, ptr interface{}) (*Binding, error) {
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: bind %s need a non-nil struct pointer, got %T ", ErrBindTarget, configFileKey, ptr)
+	}
+
+	b := &Binding{
+		configFileKey: configFileKey,
+		typ:           rv.Elem().Type(),
+		template:      deepCopy(rv.Elem()),
+	}
+	b.value.Store(b.newValue().Interface())
+
+	s.bindLock.Lock()
+	s.bindings[configFileKey] = append(s.bindings[configFileKey], b)
+	s.bindLock.Unlock()
+
+	if err := s.decodeBinding(b); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// refreshBindings 重新解码 configFileKey 对应的所有绑定
+func (s *Sail) refreshBindings(configFileKey string) {
+	s.bindLock.Lock()
+	bindings := s.bindings[configFileKey]
+	s.bindLock.Unlock()
+
+	for _, b := range bindings {
+		if err := s.decodeBinding(b); err != nil {
+			s.l.Error("decode binding fail, keep the old value. ", "key", configFileKey, "err", err)
+		}
+	}
+}
+
+// resetBindings 配置文件被删除后，绑定恢复为 Bind 时传入的默认值
+func (s *Sail) resetBindings(configFileKey string) {
+	s.bindLock.Lock()
+	bindings := s.bindings[configFileKey]
+	s.bindLock.Unlock()
+
+	for _, b := range bindings {
+		b.value.Store(b.newValue().Interface())
+		b.setErr(nil)
+	}
+}
+
+func (s *Sail) decodeBinding(b *Binding) error {
+	s.lock.RLock()
+	v, ok := s.vipers[b.configFileKey]
+	s.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	newValue := b.newValue()
+	err := v.Unmarshal(newValue.Interface())
+	if err != nil {
+		err = fmt.Errorf("unmarshal config %s err: %w ", b.configFileKey, err)
+		b.setErr(err)
+		return err
+	}
+	b.value.Store(newValue.Interface())
+	b.setErr(nil)
+	return nil
+}
@@ -0,0 +1,110 @@
+package sail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type testMySQLConf struct {
+	Database string `mapstructure:"database"`
+	DBLog    bool   `mapstructure:"db_log"`
+	MaxConn  int    `mapstructure:"max_conn"`
+}
+
+func TestSail_Bind(t *testing.T) {
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		LogLevel:      "DEBUG",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+		NamespaceKey:  "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD",
+	})
+	sail.configs = []string{"mysql.toml"}
+	sail.etcdClient = &clientv3.Client{
+		KV: &mockKV{KV: clientv3.NewKVFromKVClient(nil, nil), response: &clientv3.GetResponse{
+			Kvs: []*mvccpb.KeyValue{
+				{
+					Key:   []byte("/conf/test_project_key/test/mysql.toml"),
+					Value: []byte("database=\"127.0.0.1:3306\""),
+				},
+			},
+		}},
+	}
+
+	t.Run("BindBeforePull", func(t *testing.T) {
+		b, err := sail.Bind("mysql.toml", &testMySQLConf{MaxConn: 10})
+		require.NoError(t, err)
+		assert.Equal(t, &testMySQLConf{MaxConn: 10}, b.Load())
+
+		err = sail.pullETCDConfig()
+		require.NoError(t, err)
+
+		conf := b.Load().(*testMySQLConf)
+		assert.Equal(t, "127.0.0.1:3306", conf.Database)
+		assert.Equal(t, 10, conf.MaxConn)
+
+		ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+		ee.dealETCDMsg("/conf/test_project_key/test/mysql.toml", []byte("database=\"0.0.0.0:3306\"\ndb_log=true"), 2)
+
+		newConf := b.Load().(*testMySQLConf)
+		assert.Equal(t, "0.0.0.0:3306", newConf.Database)
+		assert.Equal(t, true, newConf.DBLog)
+		// 旧的快照不受影响
+		assert.Equal(t, "127.0.0.1:3306", conf.Database)
+	})
+
+	t.Run("BindAfterPull", func(t *testing.T) {
+		b, err := sail.Bind("mysql.toml", &testMySQLConf{})
+		require.NoError(t, err)
+		assert.Equal(t, "0.0.0.0:3306", b.Load().(*testMySQLConf).Database)
+	})
+
+	t.Run("BindNotStruct", func(t *testing.T) {
+		var i int
+		_, err := sail.Bind("mysql.toml", &i)
+		assert.ErrorIs(t, err, ErrBindTarget)
+
+		_, err = sail.Bind("mysql.toml", testMySQLConf{})
+		assert.ErrorIs(t, err, ErrBindTarget)
+	})
+}
+
+type testTagConf struct {
+	Tags  map[string]string `mapstructure:"tags"`
+	Hosts []string          `mapstructure:"hosts"`
+}
+
+func TestSail_BindReferenceFields(t *testing.T) {
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/app.toml", "hosts=[\"a\"]\n[tags]\nx=\"1\"")
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "app.toml",
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	def := &testTagConf{Tags: map[string]string{"d": "default"}, Hosts: []string{"default"}}
+	b, err := sail.Bind("app.toml", def)
+	require.NoError(t, err)
+	require.NoError(t, sail.Pull())
+
+	old := b.Load().(*testTagConf)
+	assert.Equal(t, map[string]string{"d": "default", "x": "1"}, old.Tags)
+	assert.Equal(t, []string{"a"}, old.Hosts)
+
+	ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+	ee.dealETCDMsg("/conf/test_project_key/test/app.toml", []byte("hosts=[\"b\"]\n[tags]\ny=\"2\""), 2)
+
+	// 删除的 key 不会保留，旧的快照和默认值都不受影响
+	assert.Equal(t, map[string]string{"d": "default", "y": "2"}, b.Load().(*testTagConf).Tags)
+	assert.Equal(t, map[string]string{"d": "default", "x": "1"}, old.Tags)
+	assert.Equal(t, []string{"a"}, old.Hosts)
+	assert.Equal(t, &testTagConf{Tags: map[string]string{"d": "default"}, Hosts: []string{"default"}}, def)
+}
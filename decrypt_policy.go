@@ -0,0 +1,127 @@
+package sail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// DecryptPolicy 从配置来源拉取配置时，解密失败的处理策略
+// watch 收到的变更解密失败时，都会保留内存中的旧配置
+type DecryptPolicy int
+
+const (
+	// DecryptPolicySkip 跳过该配置，Pull 不报错（默认），错误可以通过 DecryptErrors 获取
+	DecryptPolicySkip DecryptPolicy = iota
+	// DecryptPolicyFail Pull 返回 *DecryptError
+	DecryptPolicyFail
+	// DecryptPolicyLocal 使用本地备份文件中的该配置，没有备份文件时跳过
+	DecryptPolicyLocal
+)
+
+// DecryptError 配置解密失败，可以用 errors.As 获取
+type DecryptError struct {
+	ConfigFileKey string
+	Err           error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("decrypt config %s fail: %v ", e.ConfigFileKey, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// OnError 后台发生的错误回调，如解密失败（*DecryptError）、写入备份失败（*BackupError）、放弃重连（ErrRetryExhausted）
+type OnError func(err error, s *Sail)
+
+// WithDecryptPolicy 解密失败的处理策略，默认 DecryptPolicySkip
+func WithDecryptPolicy(policy DecryptPolicy) Option {
+	return optionFunc(func(v *Sail) {
+		v.decryptPolicy = policy
+	})
+}
+
+// WithLegacyPlaintext 没有 SAILENC 前缀的配置按旧格式解密失败时当作明文，默认返回 ErrDecrypt
+// 旧格式没有标识，只要 base64 解码后是完整的 AES 分组就会被当作密文，
+// 确认没有旧格式的密文、且有明文恰好满足该条件（如 token）时才开启，否则密钥错误的密文会被当作明文使用
+func WithLegacyPlaintext(legacyPlaintext bool) Option {
+	return optionFunc(func(v *Sail) {
+		v.legacyPlaintext = legacyPlaintext
+	})
+}
+
+// WithOnError 错误回调，如配置解密失败时回调 *DecryptError
+func WithOnError(f OnError) Option {
+	return optionFunc(func(v *Sail) {
+		v.errorFunc = f
+	})
+}
+
+// DecryptErrors 当前解密失败的配置，解密成功或配置被删除后移除
+func (s *Sail) DecryptErrors() map[string]*DecryptError {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	result := make(map[string]*DecryptError, len(s.decryptErrs))
+	for k, v := range s.decryptErrs {
+		result[k] = v
+	}
+	return result
+}
+
+// setDecryptError err 为 nil 时移除该配置的解密错误
+func (s *Sail) setDecryptError(configFileKey string, err *DecryptError) {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	if err == nil {
+		delete(s.decryptErrs, configFileKey)
+		return
+	}
+	s.decryptErrs[configFileKey] = err
+	s.metrics.IncDecryptFailure(configFileKey)
+}
+
+func (s *Sail) reportError(err error) {
+	s.setLastError(err)
+	if s.errorFunc != nil {
+		s.errorFunc(err, s)
+	}
+}
+
+// decryptFallback 按 DecryptPolicy 处理解密失败，返回代替的配置，为 nil 代表跳过
+// 调用方持有 s.lock，不能在这里回调或获取密钥
+func (s *Sail) decryptFallback(err *DecryptError, keys []NamespaceKey) (*viper.Viper, []byte, error) {
+	switch s.decryptPolicy {
+	case DecryptPolicyFail:
+		return nil, nil, err
+	case DecryptPolicyLocal:
+		v, raw, localErr := s.readLocalBackup(err.ConfigFileKey, keys)
+		if localErr != nil {
+			s.l.Error("decrypt config fail and can't use local file, skip it. ", "key", err.ConfigFileKey, "err", localErr)
+			return nil, nil, nil
+		}
+		s.l.Warn("decrypt config fail, using local file. ", "key", err.ConfigFileKey, "err", err.Err)
+		return v, raw, nil
+	default:
+		s.l.Error("decrypt config fail, skip it. ", "key", err.ConfigFileKey, "err", err.Err)
+		return nil, nil, nil
+	}
+}
+
+// readLocalBackup 读取单个配置的备份文件，合并模式下没有单独的备份文件
+func (s *Sail) readLocalBackup(configFileKey string, keys []NamespaceKey) (*viper.Viper, []byte, error) {
+	if len(s.metaConfig.ConfigFilePath) == 0 || s.metaConfig.MergeConfig {
+		return nil, nil, errors.New("no backup file for the config. ")
+	}
+	fileName := filepath.Join(s.metaConfig.ConfigFilePath, configFileKey)
+	if _, err := os.Stat(fileName); err != nil {
+		return nil, nil, err
+	}
+	return s.readLocalConfigFile(configFileKey, keys)
+}
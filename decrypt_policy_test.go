@@ -0,0 +1,109 @@
+package sail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSail_decryptPolicy(t *testing.T) {
+	wrongKeyContent, err := EncryptConfigContent("password=\"p@ss\"", "WRONG_NAMESPACE_KEY")
+	require.NoError(t, err)
+
+	newSail := func(t *testing.T, dir string, opts ...Option) (*Sail, *[]error) {
+		src := NewMemorySource()
+		src.Put("/conf/test_project_key/test/mysql.toml", wrongKeyContent)
+		src.Put("/conf/test_project_key/test/app.toml", "name=\"app\"")
+
+		var mu sync.Mutex
+		var reported []error
+		opts = append([]Option{WithSource(src), WithOnError(func(err error, s *Sail) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		})}, opts...)
+		sail := New(&MetaConfig{
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			NamespaceKey:   testNamespaceKey,
+			Configs:        "app.toml,mysql.toml",
+			ConfigFilePath: dir,
+		}, opts...)
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		return sail, &reported
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		sail, reported := newSail(t, "")
+		require.NoError(t, sail.Pull())
+
+		assert.Equal(t, "app", sail.MustGetString("name"))
+		assert.Nil(t, sail.MustGet("password"))
+
+		decryptErrs := sail.DecryptErrors()
+		require.Contains(t, decryptErrs, "mysql.toml")
+		assert.ErrorIs(t, decryptErrs["mysql.toml"], ErrDecrypt)
+		require.Len(t, *reported, 1)
+		var derr *DecryptError
+		require.True(t, errors.As((*reported)[0], &derr))
+		assert.Equal(t, "mysql.toml", derr.ConfigFileKey)
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		sail, reported := newSail(t, "", WithDecryptPolicy(DecryptPolicyFail))
+		err := sail.Pull()
+
+		var derr *DecryptError
+		require.True(t, errors.As(err, &derr))
+		assert.Equal(t, "mysql.toml", derr.ConfigFileKey)
+		assert.ErrorIs(t, err, ErrDecrypt)
+		assert.Len(t, *reported, 1)
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("password=\"backup\""), 0644))
+
+		sail, _ := newSail(t, dir, WithDecryptPolicy(DecryptPolicyLocal))
+		require.NoError(t, sail.Pull())
+		assert.Equal(t, "backup", sail.MustGetString("password"))
+		assert.Contains(t, sail.DecryptErrors(), "mysql.toml")
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		src := NewMemorySource()
+		src.Put("/conf/test_project_key/test/mysql.toml", "password=\"p@ss\"")
+		sail := New(&MetaConfig{
+			LogLevel:     "DEBUG",
+			ProjectKey:   "test_project_key",
+			Namespace:    "test",
+			NamespaceKey: testNamespaceKey,
+			Configs:      "mysql.toml",
+		}, WithSource(src), WithDecryptPolicy(DecryptPolicyFail))
+		require.NoError(t, sail.Err())
+		defer sail.Close()
+		require.NoError(t, sail.Pull())
+
+		// 变更解密失败时保留旧配置
+		src.Put("/conf/test_project_key/test/mysql.toml", wrongKeyContent)
+		assert.Eventually(t, func() bool {
+			return len(sail.DecryptErrors()) == 1
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, "p@ss", sail.MustGetString("password"))
+
+		src.Put("/conf/test_project_key/test/mysql.toml", "password=\"new\"")
+		assert.Eventually(t, func() bool {
+			return len(sail.DecryptErrors()) == 0 && sail.MustGetString("password") == "new"
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,251 @@
+package sail
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 加密配置的格式：SAILENC:{version}:{algorithm}[:{key_id}]:{base64 密文}
+// v1 aes-192-ecb 旧格式，同时兼容不带 SAILENC 前缀的纯 base64 密文
+// v2 aes-256-gcm 密钥为 sha256(namespaceKey)，密文为 nonce+ciphertext，头部作为附加数据参与认证
+// 带有 key_id 时只使用该 ID 的密钥解密，否则按顺序尝试所有密钥
+const (
+	envelopePrefix = "SAILENC"
+
+	envelopeV1   = "v1"
+	algAES192ECB = "aes-192-ecb"
+
+	envelopeV2   = "v2"
+	algAES256GCM = "aes-256-gcm"
+)
+
+var (
+	ErrDecrypt             = errors.New("ErrDecrypt")
+	ErrEnvelope            = errors.New("ErrEnvelope")
+	ErrNamespaceKeyMissing = errors.New("ErrNamespaceKeyMissing")
+	ErrUnknownKeyID        = errors.New("ErrUnknownKeyID")
+)
+
+// DefaultKeyID MetaConfig.NamespaceKey 在密钥环中的 ID
+const DefaultKeyID = "default"
+
+// NamespaceKey 带 ID 的命名空间密钥
+type NamespaceKey struct {
+	ID  string
+	Key string
+}
+
+// parseNamespaceKeys id1:key1,id2:key2
+func parseNamespaceKeys(keys string) ([]NamespaceKey, error) {
+	var result []NamespaceKey
+	for _, e := range strings.Split(keys, ",") {
+		e = strings.TrimSpace(e)
+		if len(e) == 0 {
+			continue
+		}
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("namespace key should be key_id:key, got %q ", kv[0])
+		}
+		result = append(result, NamespaceKey{ID: kv[0], Key: kv[1]})
+	}
+	return result, nil
+}
+
+// EncryptConfigContent 用命名空间密钥加密配置，返回 v2 格式的密文
+func EncryptConfigContent(content string, namespaceKey string) (string, error) {
+	return EncryptConfigContentWithKey(content, NamespaceKey{Key: namespaceKey})
+}
+
+// EncryptConfigContentWithKey 用命名空间密钥加密配置，密文中会带上密钥 ID
+func EncryptConfigContentWithKey(content string, key NamespaceKey) (string, error) {
+	if key.Key == "" {
+		return "", ErrNamespaceKeyMissing
+	}
+	if strings.Contains(key.ID, ":") {
+		return "", fmt.Errorf("%w: key id can't contain ':' ", ErrEnvelope)
+	}
+
+	aead, err := newGCM(key.Key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generate nonce err: %w ", err)
+	}
+
+	header := envelopeHeader(envelopeV2, algAES256GCM, key.ID)
+	sealed := aead.Seal(nonce, nonce, []byte(content), []byte(header))
+	return header + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptConfigContent 解密配置，未加密的配置原样返回
+func decryptConfigContent(content string, namespaceKey string) (string, error) {
+	var keys []NamespaceKey
+	if namespaceKey != "" {
+		keys = append(keys, NamespaceKey{ID: DefaultKeyID, Key: namespaceKey})
+	}
+	plain, _, err := decryptWithKeys(content, keys, false)
+	return plain, err
+}
+
+// decryptWithKeys 解密配置，返回解密成功的密钥 ID，未加密的配置原样返回，密钥 ID 为空
+// legacyPlaintext 为 true 时，不带 SAILENC 前缀的内容解密失败后当作明文
+func decryptWithKeys(content string, keys []NamespaceKey, legacyPlaintext bool) (string, string, error) {
+	if strings.HasPrefix(content, envelopePrefix+":") {
+		return decryptEnvelope(content, keys)
+	}
+
+	if len(keys) == 0 || !isLegacyCiphertext(content) {
+		return content, "", nil
+	}
+	plain, keyID, err := tryKeys(keys, func(key string) (string, error) {
+		return decryptLegacy(strings.TrimSpace(content), key)
+	})
+	if err != nil && legacyPlaintext {
+		return content, "", nil
+	}
+	return plain, keyID, err
+}
+
+func decryptEnvelope(content string, keys []NamespaceKey) (string, string, error) {
+	parts := strings.Split(strings.TrimSpace(content), ":")
+	if len(parts) != 4 && len(parts) != 5 {
+		return "", "", fmt.Errorf("%w: want %s:{version}:{algorithm}[:{key_id}]:{ciphertext} ", ErrEnvelope, envelopePrefix)
+	}
+	version, alg, ciphertext := parts[1], parts[2], parts[len(parts)-1]
+	keyID := ""
+	if len(parts) == 5 {
+		keyID = parts[3]
+	}
+
+	var decrypt func(key string) (string, error)
+	switch {
+	case version == envelopeV1 && alg == algAES192ECB:
+		decrypt = func(key string) (string, error) {
+			return decryptLegacy(ciphertext, key)
+		}
+	case version == envelopeV2 && alg == algAES256GCM:
+		sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: bad base64: %v ", ErrEnvelope, err)
+		}
+		decrypt = func(key string) (string, error) {
+			return decryptGCM(sealed, key, envelopeHeader(version, alg, keyID))
+		}
+	default:
+		return "", "", fmt.Errorf("%w: unsupported %s:%s ", ErrEnvelope, version, alg)
+	}
+
+	if len(keys) == 0 {
+		return "", "", ErrNamespaceKeyMissing
+	}
+	if keyID == "" {
+		return tryKeys(keys, decrypt)
+	}
+	for _, e := range keys {
+		if e.ID == keyID {
+			plain, err := decrypt(e.Key)
+			return plain, e.ID, err
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s ", ErrUnknownKeyID, keyID)
+}
+
+// tryKeys 按顺序尝试所有密钥，全部失败时返回最后一个错误
+func tryKeys(keys []NamespaceKey, decrypt func(key string) (string, error)) (string, string, error) {
+	var err error
+	for _, e := range keys {
+		var plain string
+		plain, err = decrypt(e.Key)
+		if err == nil {
+			return plain, e.ID, nil
+		}
+	}
+	return "", "", err
+}
+
+func decryptGCM(sealed []byte, namespaceKey string, header string) (string, error) {
+	aead, err := newGCM(namespaceKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: ciphertext too short ", ErrEnvelope)
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(header))
+	if err != nil {
+		return "", fmt.Errorf("%w: wrong namespace key or corrupted content ", ErrDecrypt)
+	}
+	return string(plain), nil
+}
+
+func envelopeHeader(version, alg, keyID string) string {
+	header := envelopePrefix + ":" + version + ":" + alg
+	if keyID != "" {
+		header += ":" + keyID
+	}
+	return header
+}
+
+func newGCM(namespaceKey string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(namespaceKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isLegacyCiphertext 旧格式没有标识，只有 base64 解码后是完整的 AES 分组时才尝试解密
+func isLegacyCiphertext(content string) bool {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	return err == nil && len(raw) > 0 && len(raw)%aes.BlockSize == 0
+}
+
+// decryptLegacy AES-192-ECB，密钥不足 24 位补 '0'，超出截断
+func decryptLegacy(ciphertext string, namespaceKey string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad base64: %v ", ErrEnvelope, err)
+	}
+	if len(raw) == 0 || len(raw)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("%w: ciphertext is not a multiple of the block size ", ErrEnvelope)
+	}
+
+	key := []byte(namespaceKey + strings.Repeat("0", 24))[:24]
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	plain := make([]byte, len(raw))
+	for i := 0; i < len(raw); i += aes.BlockSize {
+		block.Decrypt(plain[i:i+aes.BlockSize], raw[i:i+aes.BlockSize])
+	}
+
+	// ECB 没有认证，只能通过填充和 UTF-8 判断密钥是否正确
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return "", fmt.Errorf("%w: wrong namespace key or corrupted content ", ErrDecrypt)
+	}
+	for _, e := range plain[len(plain)-padding:] {
+		if int(e) != padding {
+			return "", fmt.Errorf("%w: wrong namespace key or corrupted content ", ErrDecrypt)
+		}
+	}
+	plain = plain[:len(plain)-padding]
+	if !utf8.Valid(plain) {
+		return "", fmt.Errorf("%w: wrong namespace key or corrupted content ", ErrDecrypt)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,108 @@
+package sail
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// 字段级加密：只加密配置中的敏感值，其余部分保持明文，便于 review 和 diff
+// 格式为 ENC[{SAILENC 密文}]，如：
+// password: ENC[SAILENC:v2:aes-256-gcm:k1:...]
+const (
+	fieldEncPrefix = "ENC["
+	fieldEncSuffix = "]"
+)
+
+// EncryptConfigValue 加密单个配置值，返回的 ENC[...] 可直接写入 YAML/TOML/JSON 配置的字符串值中
+func EncryptConfigValue(value string, key NamespaceKey) (string, error) {
+	encrypted, err := EncryptConfigContentWithKey(value, key)
+	if err != nil {
+		return "", err
+	}
+	return fieldEncPrefix + encrypted + fieldEncSuffix, nil
+}
+
+func isEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, fieldEncPrefix) && strings.HasSuffix(value, fieldEncSuffix)
+}
+
+// decryptFields 解密 v 中所有 ENC[...] 形式的值（包括列表中的值），返回用到的密钥 ID
+func decryptFields(v *viper.Viper, keys []NamespaceKey) ([]string, error) {
+	used := make(map[string]struct{})
+	for _, k := range v.AllKeys() {
+		value, changed, err := decryptFieldValue(v.Get(k), keys, used)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt field %s err: %w ", k, err)
+		}
+		if changed {
+			v.Set(k, value)
+		}
+	}
+
+	keyIDs := make([]string, 0, len(used))
+	for e := range used {
+		keyIDs = append(keyIDs, e)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs, nil
+}
+
+func decryptFieldValue(value interface{}, keys []NamespaceKey, used map[string]struct{}) (interface{}, bool, error) {
+	switch val := value.(type) {
+	case string:
+		if !isEncryptedValue(val) {
+			return val, false, nil
+		}
+		envelope := strings.TrimSuffix(strings.TrimPrefix(val, fieldEncPrefix), fieldEncSuffix)
+		if !strings.HasPrefix(envelope, envelopePrefix+":") {
+			return nil, false, fmt.Errorf("%w: want ENC[%s:...] ", ErrEnvelope, envelopePrefix)
+		}
+		plain, keyID, err := decryptEnvelope(envelope, keys)
+		if err != nil {
+			return nil, false, err
+		}
+		used[keyID] = struct{}{}
+		return plain, true, nil
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		changed := false
+		for i, e := range val {
+			item, itemChanged, err := decryptFieldValue(e, keys, used)
+			if err != nil {
+				return nil, false, err
+			}
+			result[i] = item
+			changed = changed || itemChanged
+		}
+		return result, changed, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		changed := false
+		for k, e := range val {
+			item, itemChanged, err := decryptFieldValue(e, keys, used)
+			if err != nil {
+				return nil, false, err
+			}
+			result[k] = item
+			changed = changed || itemChanged
+		}
+		return result, changed, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// decryptConfigFields 解密失败时返回 *DecryptError
+func (s *Sail) decryptConfigFields(configKey string, v *viper.Viper, keys []NamespaceKey) error {
+	keyIDs, err := decryptFields(v, keys)
+	if err != nil {
+		derr := &DecryptError{ConfigFileKey: configKey, Err: err}
+		s.setDecryptError(configKey, derr)
+		return derr
+	}
+	s.addKeyUsage(configKey, keyIDs...)
+	return nil
+}
@@ -0,0 +1,102 @@
+package sail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_decryptFields(t *testing.T) {
+	key := NamespaceKey{ID: "k1", Key: testNamespaceKey}
+	encrypt := func(value string) string {
+		encrypted, err := EncryptConfigValue(value, key)
+		require.NoError(t, err)
+		return encrypted
+	}
+
+	tests := []struct {
+		name       string
+		configType string
+		content    string
+	}{
+		{
+			name:       "yaml",
+			configType: "yaml",
+			content: fmt.Sprintf("mysql:\n  host: 127.0.0.1\n  password: %s\ntokens:\n  - %s\n  - plain\nusers:\n  - name: root\n    password: %s\n",
+				encrypt("p@ss"), encrypt("t1"), encrypt("root-pass")),
+		},
+		{
+			name:       "toml",
+			configType: "toml",
+			content: fmt.Sprintf("tokens = [%q, \"plain\"]\nusers = [{name = \"root\", password = %q}]\n[mysql]\nhost = \"127.0.0.1\"\npassword = %q\n",
+				encrypt("t1"), encrypt("root-pass"), encrypt("p@ss")),
+		},
+		{
+			name:       "json",
+			configType: "json",
+			content: fmt.Sprintf(`{"mysql": {"host": "127.0.0.1", "password": %q}, "tokens": [%q, "plain"], "users": [{"name": "root", "password": %q}]}`,
+				encrypt("p@ss"), encrypt("t1"), encrypt("root-pass")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sail := New(&MetaConfig{
+				ETCDEndpoints: "127.0.0.1:2379",
+				LogLevel:      "DEBUG",
+				ProjectKey:    "test_project_key",
+				Namespace:     "test",
+			}, WithNamespaceKeys(key))
+			require.NoError(t, sail.Err())
+
+			v, _, err := sail.newViperWithETCDValue("app."+tt.configType, []byte(tt.content), sail.keyring())
+			require.NoError(t, err)
+			require.NotNil(t, v)
+
+			assert.Equal(t, "127.0.0.1", v.GetString("mysql.host"))
+			assert.Equal(t, "p@ss", v.GetString("mysql.password"))
+			assert.Equal(t, []string{"t1", "plain"}, v.GetStringSlice("tokens"))
+			users := v.Get("users").([]interface{})
+			assert.Equal(t, "root-pass", users[0].(map[string]interface{})["password"])
+			assert.Equal(t, map[string][]string{"k1": {"app." + tt.configType}}, sail.KeysInUse())
+		})
+	}
+
+	t.Run("WrongKey", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		require.NoError(t, v.ReadConfig(strings.NewReader("password: "+encrypt("p@ss"))))
+		_, err := decryptFields(v, []NamespaceKey{{ID: "k1", Key: "WRONG_KEY"}})
+		assert.ErrorIs(t, err, ErrDecrypt)
+
+		v.Set("password", "ENC[not-an-envelope]")
+		_, err = decryptFields(v, []NamespaceKey{key})
+		assert.ErrorIs(t, err, ErrEnvelope)
+	})
+}
+
+func TestSail_readLocalFileConfig_encryptedFields(t *testing.T) {
+	password, err := EncryptConfigValue("p@ss", NamespaceKey{ID: DefaultKeyID, Key: testNamespaceKey})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.yaml"), []byte("host: 127.0.0.1\npassword: "+password), 0644))
+
+	sail := New(&MetaConfig{
+		ConfigFilePath: dir,
+		ETCDEndpoints:  "127.0.0.1:2379",
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		NamespaceKey:   testNamespaceKey,
+		Configs:        "mysql.yaml",
+	})
+	require.NoError(t, sail.readLocalFileConfig())
+	assert.Equal(t, "p@ss", sail.MustGetString("password"))
+}
@@ -0,0 +1,171 @@
+package sail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HYY-yu/seckill.pkg/pkg/encrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNamespaceKey = "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD"
+
+func TestEncryptConfigContent(t *testing.T) {
+	content := "host=0.0.0.0\nport=6379"
+
+	encrypted, err := EncryptConfigContent(content, testNamespaceKey)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "SAILENC:v2:aes-256-gcm:"))
+
+	decrypted, err := decryptConfigContent(encrypted, testNamespaceKey)
+	require.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+
+	_, err = decryptConfigContent(encrypted, "WRONG_KEY")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = decryptConfigContent(encrypted, "")
+	assert.ErrorIs(t, err, ErrNamespaceKeyMissing)
+
+	// 篡改头部会导致认证失败
+	tampered := strings.Replace(encrypted, "SAILENC:v2:aes-256-gcm:", "SAILENC:v2:aes-256-gcm: ", 1)
+	_, err = decryptConfigContent(tampered, testNamespaceKey)
+	assert.Error(t, err)
+
+	_, err = EncryptConfigContent(content, "")
+	assert.ErrorIs(t, err, ErrNamespaceKeyMissing)
+}
+
+func Test_decryptConfigContent(t *testing.T) {
+	legacy, err := encrypt.NewGoAES(testNamespaceKey, encrypt.AES192).
+		WithModel(encrypt.ECB).
+		WithEncoding(encrypt.NewBase64Encoding()).
+		Encrypt("host=0.0.0.0")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		content      string
+		namespaceKey string
+		want         string
+		wantErr      error
+	}{
+		{
+			name:         "plain",
+			content:      "database=\"127.0.0.1:3306\"",
+			namespaceKey: testNamespaceKey,
+			want:         "database=\"127.0.0.1:3306\"",
+		},
+		{
+			name:         "plainLooksLikeBase64",
+			content:      "ca",
+			namespaceKey: testNamespaceKey,
+			want:         "ca",
+		},
+		{
+			name:         "legacy",
+			content:      legacy,
+			namespaceKey: testNamespaceKey,
+			want:         "host=0.0.0.0",
+		},
+		{
+			name:         "legacyEnvelope",
+			content:      "SAILENC:v1:aes-192-ecb:" + legacy,
+			namespaceKey: testNamespaceKey,
+			want:         "host=0.0.0.0",
+		},
+		{
+			name:         "legacyWrongKey",
+			content:      legacy,
+			namespaceKey: "WRONG_KEY",
+			wantErr:      ErrDecrypt,
+		},
+		{
+			name:         "plainLooksLikeLegacy",
+			content:      "MDEyMzQ1Njc4OWFiY2RlZg==",
+			namespaceKey: testNamespaceKey,
+			wantErr:      ErrDecrypt,
+		},
+		{
+			name:         "legacyWithoutKey",
+			content:      legacy,
+			namespaceKey: "",
+			want:         legacy,
+		},
+		{
+			name:         "unknownEnvelope",
+			content:      "SAILENC:v9:rot13:abc",
+			namespaceKey: testNamespaceKey,
+			wantErr:      ErrEnvelope,
+		},
+		{
+			name:         "badEnvelope",
+			content:      "SAILENC:v2",
+			namespaceKey: testNamespaceKey,
+			wantErr:      ErrEnvelope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptConfigContent(tt.content, tt.namespaceKey)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSail_plainLooksLikeLegacy(t *testing.T) {
+	// base64 解码后恰好是 16 字节，但不是密文
+	token := "MDEyMzQ1Njc4OWFiY2RlZg=="
+	legacy, err := encrypt.NewGoAES(testNamespaceKey, encrypt.AES192).
+		WithModel(encrypt.ECB).
+		WithEncoding(encrypt.NewBase64Encoding()).
+		Encrypt("host=0.0.0.0")
+	require.NoError(t, err)
+
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/token.custom", token)
+	src.Put("/conf/test_project_key/test/redis.properties", legacy)
+	newSail := func(t *testing.T, namespaceKey string, opts ...Option) *Sail {
+		sail := New(&MetaConfig{
+			LogLevel:     "DEBUG",
+			ProjectKey:   "test_project_key",
+			Namespace:    "test",
+			NamespaceKey: namespaceKey,
+			Configs:      "redis.properties,token.custom",
+		}, append([]Option{WithSource(src)}, opts...)...)
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		return sail
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		// 无法区分，按密钥错误处理
+		sail := newSail(t, testNamespaceKey)
+		require.NoError(t, sail.Pull())
+		assert.ErrorIs(t, sail.DecryptErrors()["token.custom"], ErrDecrypt)
+		assert.Equal(t, "0.0.0.0", sail.MustGetString("host"))
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		sail := newSail(t, "WRONG_NAMESPACE_KEY", WithDecryptPolicy(DecryptPolicyFail))
+		assert.ErrorIs(t, sail.Pull(), ErrDecrypt)
+	})
+
+	t.Run("LegacyPlaintext", func(t *testing.T) {
+		sail := newSail(t, testNamespaceKey, WithLegacyPlaintext(true))
+		require.NoError(t, sail.Pull())
+		raw, err := sail.GetRaw("token.custom")
+		require.NoError(t, err)
+		assert.Equal(t, token, string(raw))
+		assert.Empty(t, sail.DecryptErrors())
+		assert.Equal(t, "0.0.0.0", sail.MustGetString("host"))
+	})
+}
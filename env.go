@@ -17,10 +17,20 @@ func getMetaFormEnv() *MetaConfig {
 		ProjectKey:     os.Getenv("SAIL_PROJECT_KEY"),
 		Namespace:      os.Getenv("SAIL_NAMESPACE"),
 		NamespaceKey:   os.Getenv("SAIL_NAMESPACE_KEY"),
+		NamespaceKeys:  os.Getenv("SAIL_NAMESPACE_KEYS"),
+		KeyProvider:    os.Getenv("SAIL_KEY_PROVIDER"),
 		Configs:        os.Getenv("SAIL_CONFIGS"),
 		ConfigFilePath: os.Getenv("SAIL_CONFIG_FILE_PATH"),
 		LogLevel:       os.Getenv("SAIL_LOG_LEVEL"),
+		InstanceLabels: os.Getenv("SAIL_INSTANCE_LABELS"),
+		BackupMode:     os.Getenv("SAIL_BACKUP_MODE"),
+		BackupKey:      os.Getenv("SAIL_BACKUP_KEY"),
+		OutputMode:     os.Getenv("SAIL_OUTPUT_MODE"),
 	}
 	meta.MergeConfig, _ = strconv.ParseBool(os.Getenv("SAIL_MERGE_CONFIG"))
+	meta.WatchNamespace, _ = strconv.ParseBool(os.Getenv("SAIL_WATCH_NAMESPACE"))
+	meta.HistoryLimit, _ = strconv.Atoi(os.Getenv("SAIL_HISTORY_LIMIT"))
+	meta.LocalFirst, _ = strconv.ParseBool(os.Getenv("SAIL_LOCAL_FIRST"))
+	meta.PublishOnly, _ = strconv.ParseBool(os.Getenv("SAIL_PUBLISH_ONLY"))
 	return &meta
 }
@@ -0,0 +1,81 @@
+package sail
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// FallbackPolicy 无法从配置来源拉取配置时，哪些错误可以改用本地备份文件，可以组合使用
+// 使用本地备份文件后会在后台按 RetryPolicy 重连
+type FallbackPolicy int
+
+const (
+	// FallbackOnConnectError 无法连接配置来源，如超时、DNS、TLS、鉴权失败
+	FallbackOnConnectError FallbackPolicy = 1 << iota
+	// FallbackOnReadError 连接成功但拉取配置失败，或拉取到的配置为空
+	FallbackOnReadError
+
+	// FallbackNever 总是返回错误
+	FallbackNever FallbackPolicy = 0
+	// DefaultFallbackPolicy 默认的策略，连接和拉取失败都使用本地备份文件
+	DefaultFallbackPolicy = FallbackOnConnectError | FallbackOnReadError
+)
+
+// ConfigOrigin 配置的来源
+type ConfigOrigin string
+
+const (
+	// OriginRemote 来自配置来源，默认为 ETCD
+	OriginRemote ConfigOrigin = "remote"
+	// OriginLocal 来自本地备份文件或历史版本
+	OriginLocal ConfigOrigin = "local"
+)
+
+// WithFallbackPolicy 无法拉取配置时使用本地备份文件的策略，默认 DefaultFallbackPolicy
+func WithFallbackPolicy(policy FallbackPolicy) Option {
+	return optionFunc(func(v *Sail) {
+		v.fallbackPolicy = policy
+	})
+}
+
+// ConfigOrigins 当前每个配置的来源
+func (s *Sail) ConfigOrigins() map[string]ConfigOrigin {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := make(map[string]ConfigOrigin, len(s.origins))
+	for k, v := range s.origins {
+		result[k] = v
+	}
+	return result
+}
+
+// fallbackLocal 按 FallbackPolicy 改用本地备份文件，并在后台重连
+// 不允许或本地没有可用的备份文件时返回 cause
+func (s *Sail) fallbackLocal(kind FallbackPolicy, cause error) error {
+	var derr *DecryptError
+	if errors.As(cause, &derr) {
+		// DecryptPolicyFail 要求拉取失败
+		return cause
+	}
+	if s.fallbackPolicy&kind == 0 || len(s.metaConfig.ConfigFilePath) == 0 {
+		return cause
+	}
+
+	s.l.Warn("using local file because can't pull config, the connection will retry in background. ", "err", cause)
+	s.setLastError(cause)
+	if err := s.readLocalFileConfig(); err != nil {
+		return fmt.Errorf("%v, read local file fail: %w ", cause, err)
+	}
+	s.lock.RLock()
+	loaded := len(s.vipers)
+	s.lock.RUnlock()
+	if loaded == 0 {
+		return fmt.Errorf("%w, no local file can be used ", cause)
+	}
+
+	atomic.StoreInt32(&s.reconnecting, 1)
+	go s.reconnectEtcd()
+	return nil
+}
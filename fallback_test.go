@@ -0,0 +1,107 @@
+package sail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySource List 在 down 时返回错误
+type flakySource struct {
+	*MemorySource
+	down int32
+}
+
+func (f *flakySource) List(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	if atomic.LoadInt32(&f.down) == 1 {
+		return nil, 0, errors.New("permission denied")
+	}
+	return f.MemorySource.List(ctx, prefix)
+}
+
+func TestSail_fallbackLocal(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("database=\"local\""), 0644))
+
+	newSail := func(t *testing.T, opts ...Option) (*Sail, *flakySource) {
+		src := &flakySource{MemorySource: NewMemorySource(), down: 1}
+		src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+		opts = append([]Option{WithSource(src), WithRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			Multiplier:     2,
+		})}, opts...)
+		sail := New(&MetaConfig{
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "mysql.toml",
+			ConfigFilePath: dir,
+		}, opts...)
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		return sail, src
+	}
+
+	t.Run("Never", func(t *testing.T) {
+		sail, _ := newSail(t, WithFallbackPolicy(FallbackNever))
+		assert.Error(t, sail.Pull())
+		assert.Empty(t, sail.ConfigOrigins())
+	})
+
+	t.Run("ReadError", func(t *testing.T) {
+		sail, src := newSail(t)
+		require.NoError(t, sail.Pull())
+		assert.Equal(t, "local", sail.MustGetString("database"))
+		assert.Equal(t, map[string]ConfigOrigin{"mysql.toml": OriginLocal}, sail.ConfigOrigins())
+
+		// 配置来源恢复后在后台重新拉取
+		atomic.StoreInt32(&src.down, 0)
+		assert.Eventually(t, func() bool {
+			return sail.ConfigOrigins()["mysql.toml"] == OriginRemote
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, "remote", sail.MustGetString("database"))
+	})
+}
+
+func TestSail_backupWriteErrorIsNotReadError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("database=\"stale\""), 0644))
+
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+	// KeyProvider 取不到密钥，加密备份文件总是失败
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+		BackupMode:     "encrypt",
+	}, WithSource(src), WithKeyProvider(NewEnvKeyProvider("SAIL_TEST_MISSING_KEY")))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, "remote", sail.MustGetString("database"))
+	assert.Equal(t, map[string]ConfigOrigin{"mysql.toml": OriginRemote}, sail.ConfigOrigins())
+	assert.True(t, sail.WatchHealth().Running)
+	assert.Eventually(t, func() bool {
+		return sail.BackupErrors()["mysql.toml"] != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, sail.BackupErrors()["mysql.toml"], ErrNamespaceKeyMissing)
+
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"new\"")
+	assert.Eventually(t, func() bool {
+		return sail.MustGetString("database") == "new"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/spf13/viper"
 	"go.etcd.io/etcd/client/pkg/v3/fileutil"
 )
 
@@ -15,17 +17,28 @@ import (
 // 2. 如果设置mergeConfig，则mergeViper后，再写成文件。
 // 3. 有watch事件，把对应viper的配置重新写成文件。
 // 4. 有mergeConfig，重新mergeViper，覆盖写。
-// 文件默认不加密
+// 文件默认不加密，可以通过 BackupMode 加密或不写入加密过的配置
 type FileMaintainer struct {
 	sail *Sail
 
 	ctx context.Context
+
+	manifestLock sync.Mutex
+	manifest     *Manifest
+
+	snapshotLock sync.Mutex
+
+	// writeLock 保证 Pull 和后台写入协程不会同时写备份目录
+	writeLock   sync.Mutex
+	writer      *backupWriter
+	startWriter sync.Once
 }
 
 func NewFileMaintainer(sail *Sail) *FileMaintainer {
 	return &FileMaintainer{
-		sail: sail,
-		ctx:  sail.ctx,
+		sail:   sail,
+		ctx:    sail.ctx,
+		writer: newBackupWriter(),
 	}
 }
 
@@ -33,17 +46,27 @@ func (f *FileMaintainer) saveConfigFile() error {
 	if len(f.sail.metaConfig.ConfigFilePath) == 0 {
 		return nil
 	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if err := f.saveOutputFiles(); err != nil {
+		return err
+	}
+	return f.saveHistory()
+}
+
+// saveOutputFiles 按 OutputMode 写入所有备份文件，调用方需持有 writeLock
+func (f *FileMaintainer) saveOutputFiles() error {
+	if f.sail.outputMode == OutputAtomicDir {
+		return f.writeSnapshot()
+	}
 
 	if f.sail.metaConfig.MergeConfig {
-		mergeViper, err := f.sail.MergeVipersWithName()
+		mergeViper, err := f.mergeBackupVipers()
 		if err != nil {
 			return err
 		}
-		err = mergeViper.WriteConfigAs(filepath.Join(f.sail.metaConfig.ConfigFilePath, MergeConfigName))
-		if err != nil {
-			return err
-		}
-		return nil
+		return f.writeMergeConfigFile(mergeViper, f.sail.loadRevision())
 	}
 
 	// 删掉原先的配置
@@ -51,15 +74,27 @@ func (f *FileMaintainer) saveConfigFile() error {
 	if err != nil {
 		return fmt.Errorf("read config file path err: %w ", err)
 	}
+	f.cleanTempFiles(dirFiles)
 	deleteConfigFileMap := make(map[string]int)
 	for i, e := range dirFiles {
+		if isInternalFile(e) {
+			continue
+		}
 		deleteConfigFileMap[e] = i
 	}
 
 	f.sail.lock.RLock()
 	defer f.sail.lock.RUnlock()
 	for k, v := range f.sail.vipers {
-		err := v.WriteConfigAs(filepath.Join(f.sail.metaConfig.ConfigFilePath, k))
+		if f.skipBackup(k) {
+			// 保留在 deleteConfigFileMap 中，删掉之前写入的备份
+			continue
+		}
+		content, err := f.configFileContent(k, v)
+		if err != nil {
+			return err
+		}
+		err = f.writeConfigFile(k, content, f.sail.revisions[k])
 		if err != nil {
 			return err
 		}
@@ -70,7 +105,7 @@ func (f *FileMaintainer) saveConfigFile() error {
 	}
 
 	for k := range deleteConfigFileMap {
-		err := os.Remove(filepath.Join(f.sail.metaConfig.ConfigFilePath, k))
+		err := f.removeConfigFile(k)
 		if err != nil {
 			// 没删掉，也不影响正常运行
 			f.sail.l.Warn("can't delete file. ", "config_file", k)
@@ -79,31 +114,54 @@ func (f *FileMaintainer) saveConfigFile() error {
 	return nil
 }
 
+// asyncWriteConfigFile 交给后台写入协程，不阻塞 watch
 func (f *FileMaintainer) asyncWriteConfigFile(configFileKey string) {
-	go func() {
-		f.sail.lock.RLock()
-		defer f.sail.lock.RUnlock()
-
-		if f.sail.metaConfig.MergeConfig {
-			mergeViper, err := f.sail.MergeVipersWithName()
-			if err != nil {
-				f.sail.l.Error("merged merge config file fail. ", "config_file", configFileKey)
-			}
-			err = mergeViper.WriteConfigAs(filepath.Join(f.sail.metaConfig.ConfigFilePath, MergeConfigName))
-			if err != nil {
-				f.sail.l.Error("merged refresh config file fail. ", "config_file", configFileKey)
-			}
-			return
-		}
+	f.enqueueWrite(configFileKey)
+}
 
-		v, ok := f.sail.vipers[configFileKey]
-		if !ok {
-			return
-		}
+// skipBackup BackupMemory 时加密过的配置不写入备份
+func (f *FileMaintainer) skipBackup(configFileKey string) bool {
+	return f.sail.backupMode == BackupMemory && f.sail.isSecretConfig(configFileKey)
+}
 
-		err := v.WriteConfigAs(filepath.Join(f.sail.metaConfig.ConfigFilePath, configFileKey))
-		if err != nil {
-			f.sail.l.Error("refresh config file fail. ", "config_file", configFileKey)
-		}
-	}()
+// mergeBackupVipers 从本地读取的合并配置不再合并进输出，否则每次写入都会嵌套一层
+func (f *FileMaintainer) mergeBackupVipers() (*viper.Viper, error) {
+	return f.sail.mergeVipersWithName(func(configFileKey string) bool {
+		return configFileKey == MergeConfigName || f.skipBackup(configFileKey)
+	})
+}
+
+// configFileContent 原样写入解密后的原始内容，调用方需持有 sail.lock
+func (f *FileMaintainer) configFileContent(configFileKey string, v *viper.Viper) ([]byte, error) {
+	if raw, ok := f.sail.raws[configFileKey]; ok {
+		return raw, nil
+	}
+	content, err := encodeViper(configFileKey, v)
+	if err != nil {
+		return nil, fmt.Errorf("encode config file %s err: %w ", configFileKey, err)
+	}
+	return content, nil
+}
+
+// writeMergeConfigFile 合并后的配置没有原始内容，由 viper 序列化
+func (f *FileMaintainer) writeMergeConfigFile(mergeViper *viper.Viper, revision int64) error {
+	content, err := encodeViper(MergeConfigName, mergeViper)
+	if err != nil {
+		return fmt.Errorf("encode config file %s err: %w ", MergeConfigName, err)
+	}
+	return f.writeConfigFile(MergeConfigName, content, revision)
+}
+
+// removeConfigFile 删除备份文件及其在清单中的记录，文件不存在时不报错
+func (f *FileMaintainer) removeConfigFile(fileName string) error {
+	err := os.Remove(filepath.Join(f.sail.metaConfig.ConfigFilePath, fileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.updateManifest(fileName, nil)
+}
+
+// asyncRemoveConfigFile 内存中的配置已被删除，写入协程会删除对应的备份文件
+func (f *FileMaintainer) asyncRemoveConfigFile(configFileKey string) {
+	f.enqueueWrite(configFileKey)
 }
@@ -99,8 +99,12 @@ func TestFileMaintainer_saveConfigFile(t *testing.T) {
 				return
 			}
 
+			assert.Contains(t, dirFiles, ManifestFileName)
 			for _, e := range dirFiles {
 				t.Logf("Find config file: %s", e)
+				if isInternalFile(e) {
+					continue
+				}
 				assert.Contains(t, sail.configs, e)
 
 				assert.NotEqual(t, "must_delete.toml", e)
@@ -25,10 +25,20 @@ func getMetaConfigFormFlag() (*MetaConfig, error) {
 	pflag.StringVar(&meta.ProjectKey, "sail-project-key", "", "")
 	pflag.StringVar(&meta.Namespace, "sail-namespace", "", "")
 	pflag.StringVar(&meta.NamespaceKey, "sail-namespace-key", "", "")
+	pflag.StringVar(&meta.NamespaceKeys, "sail-namespace-keys", "", "")
+	pflag.StringVar(&meta.KeyProvider, "sail-key-provider", "", "")
 	pflag.StringVar(&meta.Configs, "sail-configs", "", "")
 	pflag.StringVar(&meta.ConfigFilePath, "sail-config-file-path", "", "")
 	pflag.StringVar(&meta.LogLevel, "sail-log-level", "", "")
+	pflag.StringVar(&meta.InstanceLabels, "sail-instance-labels", "", "")
+	pflag.StringVar(&meta.BackupMode, "sail-backup-mode", "", "")
+	pflag.StringVar(&meta.BackupKey, "sail-backup-key", "", "")
+	pflag.StringVar(&meta.OutputMode, "sail-output-mode", "", "")
 	pflag.BoolVar(&meta.MergeConfig, "sail-merge-config", false, "")
+	pflag.BoolVar(&meta.WatchNamespace, "sail-watch-namespace", false, "")
+	pflag.IntVar(&meta.HistoryLimit, "sail-history-limit", 0, "")
+	pflag.BoolVar(&meta.LocalFirst, "sail-local-first", false, "")
+	pflag.BoolVar(&meta.PublishOnly, "sail-publish-only", false, "")
 
 	err := pflag.CommandLine.Parse(os.Args[1:])
 	if err != nil {
@@ -21,9 +21,25 @@ func (g *GetError) Error() string {
 }
 
 var (
-	ErrDuplicateKey = errors.New("ErrDuplicateKey")
+	ErrDuplicateKey   = errors.New("ErrDuplicateKey")
+	ErrConfigNotFound = errors.New("ErrConfigNotFound")
 )
 
+// GetRaw 配置文件解密后的原始内容，与发布的内容逐字节一致
+// 字段级加密的 ENC[...] 值保持原样；合并模式下从本地读取时只有 config.toml
+func (s *Sail) GetRaw(configFileKey string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	raw, ok := s.raws[configFileKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s ", ErrConfigNotFound, configFileKey)
+	}
+	result := make([]byte, len(raw))
+	copy(result, raw)
+	return result, nil
+}
+
 func (s *Sail) Get(key string) (interface{}, error) {
 	return s.rangeVipers(key)
 }
@@ -34,7 +50,7 @@ func (s *Sail) MustGet(key string) interface{} {
 }
 
 func (s *Sail) GetWithName(key string, name string) interface{} {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.Get(key)
 	}
 	return nil
@@ -51,7 +67,7 @@ func (s *Sail) MustGetString(key string) string {
 }
 
 func (s *Sail) GetStringWithName(key string, name string) string {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetString(key)
 	}
 	return ""
@@ -68,7 +84,7 @@ func (s *Sail) MustGetBool(key string) bool {
 }
 
 func (s *Sail) GetBoolWithName(key string, name string) bool {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetBool(key)
 	}
 	return false
@@ -85,7 +101,7 @@ func (s *Sail) MustGetInt(key string) int {
 }
 
 func (s *Sail) GetIntWithName(key string, name string) int {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetInt(key)
 	}
 	return 0
@@ -102,7 +118,7 @@ func (s *Sail) MustGetInt32(key string) int32 {
 }
 
 func (s *Sail) GetInt32WithName(key string, name string) int32 {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetInt32(key)
 	}
 	return 0
@@ -119,7 +135,7 @@ func (s *Sail) MustGetInt64(key string) int64 {
 }
 
 func (s *Sail) GetInt64WithName(key string, name string) int64 {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetInt64(key)
 	}
 	return 0
@@ -136,7 +152,7 @@ func (s *Sail) MustGetUint(key string) uint {
 }
 
 func (s *Sail) GetUintWithName(key string, name string) uint {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetUint(key)
 	}
 	return 0
@@ -153,7 +169,7 @@ func (s *Sail) MustGetFloat64(key string) float64 {
 }
 
 func (s *Sail) GetFloat64WithName(key string, name string) float64 {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetFloat64(key)
 	}
 	return 0
@@ -170,7 +186,7 @@ func (s *Sail) MustGetTime(key string) time.Time {
 }
 
 func (s *Sail) GetTimeWithName(key string, name string) time.Time {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetTime(key)
 	}
 	return time.Time{}
@@ -187,7 +203,7 @@ func (s *Sail) MustGetDuration(key string) time.Duration {
 }
 
 func (s *Sail) GetDurationWithName(key string, name string) time.Duration {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetDuration(key)
 	}
 	return 0
@@ -204,7 +220,7 @@ func (s *Sail) MustGetIntSlice(key string) []int {
 }
 
 func (s *Sail) GetIntSliceWithName(key string, name string) []int {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetIntSlice(key)
 	}
 	return nil
@@ -221,7 +237,7 @@ func (s *Sail) MustGetStringSlice(key string) []string {
 }
 
 func (s *Sail) GetStringSliceWithName(key string, name string) []string {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetStringSlice(key)
 	}
 	return nil
@@ -238,7 +254,7 @@ func (s *Sail) MustGetStringMap(key string) map[string]interface{} {
 }
 
 func (s *Sail) GetStringMapWithName(key string, name string) map[string]interface{} {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetStringMap(key)
 	}
 	return nil
@@ -255,7 +271,7 @@ func (s *Sail) MustGetStringMapString(key string) map[string]string {
 }
 
 func (s *Sail) GetStringMapStringWithName(key string, name string) map[string]string {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetStringMapString(key)
 	}
 	return nil
@@ -272,7 +288,7 @@ func (s *Sail) MustGetStringMapStringSlice(key string) map[string][]string {
 }
 
 func (s *Sail) GetStringMapStringSliceWithName(key string, name string) map[string][]string {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetStringMapStringSlice(key)
 	}
 	return nil
@@ -289,14 +305,14 @@ func (s *Sail) MustGetSizeInBytes(key string) uint {
 }
 
 func (s *Sail) GetSizeInBytesWithName(key string, name string) uint {
-	if v, ok := s.vipers[name]; ok {
+	if v, ok := s.viperWithName(name); ok {
 		return v.GetSizeInBytes(key)
 	}
 	return 0
 }
 
 func (s *Sail) GetViperWithName(name string) *viper.Viper {
-	v, ok := s.vipers[name]
+	v, ok := s.viperWithName(name)
 	if !ok {
 		return nil
 	}
@@ -327,11 +343,19 @@ func (s *Sail) MergeVipers() (*viper.Viper, error) {
 // MergeVipersWithName 后：
 // viper.Get("mysql.toml.key")
 func (s *Sail) MergeVipersWithName() (*viper.Viper, error) {
+	return s.mergeVipersWithName(nil)
+}
+
+// mergeVipersWithName skip 返回 true 的配置文件不参与合并
+func (s *Sail) mergeVipersWithName(skip func(configFileKey string) bool) (*viper.Viper, error) {
 	newViper := viper.New()
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
 	for k, v := range s.vipers {
+		if skip != nil && skip(k) {
+			continue
+		}
 		dataMap := v.AllSettings()
 
 		err := newViper.MergeConfigMap(map[string]interface{}{
@@ -344,10 +368,15 @@ func (s *Sail) MergeVipersWithName() (*viper.Viper, error) {
 	return newViper, nil
 }
 
+// viperWithName 配置随时会被监听协程替换或删除，读取时需持有读锁
+func (s *Sail) viperWithName(name string) (*viper.Viper, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	v, ok := s.vipers[name]
+	return v, ok
+}
+
 func (s *Sail) rangeVipers(key string) (interface{}, error) {
-	if len(s.vipers) == 0 {
-		return nil, nil
-	}
 	var result interface{}
 	var duResult []string
 
@@ -1,6 +1,8 @@
 package sail
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -198,3 +200,39 @@ func initSail(t *testing.T) *Sail {
 
 	return sail
 }
+
+func TestSail_GetRaw(t *testing.T) {
+	content := "# 注释会保留\nDatabase = \"127.0.0.1:3306\"\nPool = 10\n"
+	encrypted, err := EncryptConfigContent(content, testNamespaceKey)
+	require.NoError(t, err)
+
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", encrypted)
+	src.Put("/conf/test_project_key/test/app.custom", "raw text")
+	dir := t.TempDir()
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		NamespaceKey:   testNamespaceKey,
+		Configs:        "app.custom,mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.Pull())
+
+	raw, err := sail.GetRaw("mysql.toml")
+	require.NoError(t, err)
+	assert.Equal(t, content, string(raw))
+
+	// 备份文件与发布的内容逐字节一致
+	for k, want := range map[string]string{"mysql.toml": content, "app.custom": "raw text"} {
+		backup, err := os.ReadFile(filepath.Join(dir, k))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(backup))
+	}
+
+	_, err = sail.GetRaw("redis.toml")
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+}
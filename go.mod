@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/HYY-yu/seckill.pkg v1.3.4
 	github.com/pelletier/go-toml/v2 v2.0.5
+	github.com/prometheus/client_golang v1.12.2
 	github.com/spf13/afero v1.8.2
 	github.com/spf13/cast v1.5.0
 	github.com/spf13/jwalterweatherman v1.1.0
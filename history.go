@@ -0,0 +1,201 @@
+package sail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// HistoryDirName 备份目录下保存历史版本的目录，结构为 .history/<configFileKey>/<revision>
+const HistoryDirName = ".history"
+
+var ErrHistoryNotFound = errors.New("ErrHistoryNotFound")
+
+// WithHistoryLimit 每个配置在本地保留最近的 n 个版本，0 为不保留
+func WithHistoryLimit(n int) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.HistoryLimit = n
+	})
+}
+
+func (s *Sail) historyDir(configFileKey string) string {
+	return filepath.Join(s.metaConfig.ConfigFilePath, HistoryDirName, configFileKey)
+}
+
+// History 本地保存的该配置的历史版本，按 revision 从新到旧排列
+func (s *Sail) History(configFileKey string) ([]int64, error) {
+	if len(s.metaConfig.ConfigFilePath) == 0 {
+		return nil, nil
+	}
+	revisions, err := listHistory(s.historyDir(configFileKey))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i] > revisions[j]
+	})
+	return revisions, nil
+}
+
+// Rollback 把该配置回滚到本地保存的历史版本，直到配置中心下一次发布该配置
+// 期间重新拉取到的同一版本不会覆盖回滚后的配置
+func (s *Sail) Rollback(configFileKey string, revision int64) error {
+	if len(s.metaConfig.ConfigFilePath) == 0 {
+		return fmt.Errorf("%w: config file path is empty ", ErrHistoryNotFound)
+	}
+	content, err := os.ReadFile(filepath.Join(s.historyDir(configFileKey), strconv.FormatInt(revision, 10)))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s at revision %d ", ErrHistoryNotFound, configFileKey, revision)
+	}
+	if err != nil {
+		return fmt.Errorf("read history err: %w ", err)
+	}
+	viperFile, raw, err := s.newLocalViper(configFileKey, content, s.keyring())
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	oldViper := s.vipers[configFileKey]
+	if pin, ok := s.pins[configFileKey]; !ok || pin < s.revisions[configFileKey] {
+		s.pins[configFileKey] = s.revisions[configFileKey]
+	}
+	s.vipers[configFileKey] = viperFile
+	s.raws[configFileKey] = raw
+	s.revisions[configFileKey] = revision
+	s.origins[configFileKey] = OriginLocal
+	s.lock.Unlock()
+
+	s.l.Warn("config was rolled back. ", "key", configFileKey, "revision", revision)
+	s.metrics.SetConfigUpdated(configFileKey, time.Now())
+	s.refreshBindings(configFileKey)
+	s.notifyKeyChange(configFileKey, oldViper, viperFile, revision)
+	s.fm.asyncWriteConfigFile(configFileKey)
+	return nil
+}
+
+// Pinned 当前被回滚的配置，值为回滚时配置中心的 revision
+func (s *Sail) Pinned() map[string]int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := make(map[string]int64, len(s.pins))
+	for k, v := range s.pins {
+		result[k] = v
+	}
+	return result
+}
+
+// keepPinned 拉取到的配置不比回滚时新，继续使用回滚后的配置，调用方需持有 s.lock
+func (s *Sail) keepPinned(configFileKey string, revision int64) bool {
+	pin, ok := s.pins[configFileKey]
+	if !ok {
+		return false
+	}
+	if revision > pin {
+		delete(s.pins, configFileKey)
+		return false
+	}
+	return true
+}
+
+func listHistory(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history dir err: %w ", err)
+	}
+	revisions := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		// 跳过写入中的临时文件
+		revision, err := strconv.ParseInt(e.Name(), 10, 64)
+		if err != nil || e.IsDir() {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// writeHistory 保存配置的当前版本并清理超出 HistoryLimit 的旧版本
+func (f *FileMaintainer) writeHistory(configFileKey string) error {
+	if f.sail.metaConfig.HistoryLimit <= 0 || f.skipBackup(configFileKey) {
+		return nil
+	}
+
+	f.sail.lock.RLock()
+	v, ok := f.sail.vipers[configFileKey]
+	revision := f.sail.revisions[configFileKey]
+	var content []byte
+	var err error
+	if ok && revision > 0 {
+		content, err = f.configFileContent(configFileKey, v)
+	}
+	f.sail.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		// 配置已被删除，或不知道 revision
+		return nil
+	}
+
+	dir := f.sail.historyDir(configFileKey)
+	fileName := filepath.Join(dir, strconv.FormatInt(revision, 10))
+	if _, err := os.Stat(fileName); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create history dir err: %w ", err)
+	}
+	content, err = f.encodeBackup(configFileKey, content)
+	if err != nil {
+		return err
+	}
+	if err := atomicWriteFile(fileName, content, backupFilePerm); err != nil {
+		return fmt.Errorf("write history %s err: %w ", configFileKey, err)
+	}
+
+	revisions, err := listHistory(dir)
+	if err != nil {
+		return err
+	}
+	if len(revisions) <= f.sail.metaConfig.HistoryLimit {
+		return nil
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i] < revisions[j]
+	})
+	for _, e := range revisions[:len(revisions)-f.sail.metaConfig.HistoryLimit] {
+		if err := os.Remove(filepath.Join(dir, strconv.FormatInt(e, 10))); err != nil && !os.IsNotExist(err) {
+			f.sail.l.Warn("can't delete history. ", "config_file", configFileKey, "revision", e, "err", err)
+		}
+	}
+	return nil
+}
+
+// saveHistory Pull 后保存所有配置的当前版本
+func (f *FileMaintainer) saveHistory() error {
+	if f.sail.metaConfig.HistoryLimit <= 0 {
+		return nil
+	}
+	f.sail.lock.RLock()
+	configFileKeys := make([]string, 0, len(f.sail.vipers))
+	for k := range f.sail.vipers {
+		configFileKeys = append(configFileKeys, k)
+	}
+	f.sail.lock.RUnlock()
+
+	for _, k := range configFileKeys {
+		if err := f.writeHistory(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package sail
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSail_History(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=1")
+
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src), WithHistoryLimit(2))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.Pull())
+
+	rev2 := src.Put("/conf/test_project_key/test/mysql.toml", "version=2")
+	assert.Eventually(t, func() bool {
+		history, err := sail.History("mysql.toml")
+		return err == nil && len(history) == 2 && history[0] == rev2
+	}, time.Second, 10*time.Millisecond)
+	rev3 := src.Put("/conf/test_project_key/test/mysql.toml", "version=3")
+	assert.Eventually(t, func() bool {
+		history, err := sail.History("mysql.toml")
+		return err == nil && assert.ObjectsAreEqual([]int64{rev3, rev2}, history)
+	}, time.Second, 10*time.Millisecond)
+
+	content, err := os.ReadFile(filepath.Join(dir, HistoryDirName, "mysql.toml", strconv.FormatInt(rev2, 10)))
+	require.NoError(t, err)
+	assert.Equal(t, "version=2", string(content))
+
+	assert.ErrorIs(t, sail.Rollback("mysql.toml", rev3+100), ErrHistoryNotFound)
+
+	require.NoError(t, sail.Rollback("mysql.toml", rev2))
+	assert.Equal(t, 2, sail.MustGetInt("version"))
+	assert.Equal(t, map[string]int64{"mysql.toml": rev3}, sail.Pinned())
+
+	// 重新拉取到同一版本，继续使用回滚后的配置
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, 2, sail.MustGetInt("version"))
+
+	// 下一次发布解除回滚
+	src.Put("/conf/test_project_key/test/mysql.toml", "version=4")
+	assert.Eventually(t, func() bool {
+		return sail.MustGetInt("version") == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, sail.Pinned())
+}
@@ -0,0 +1,159 @@
+package sail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrKeyProvider = errors.New("ErrKeyProvider")
+
+// KeyProvider 命名空间密钥的来源，避免密钥明文出现在配置文件、环境变量或进程参数中
+type KeyProvider interface {
+	// Keys 当前可用的密钥，按优先级排序
+	Keys() ([]NamespaceKey, error)
+}
+
+// 密钥内容的格式：
+// 单个密钥：直接是密钥本身，ID 为 DefaultKeyID
+// 多个密钥：每行或逗号分隔的 key_id:key
+func parseKeyContent(content string) ([]NamespaceKey, error) {
+	content = strings.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: empty key ", ErrKeyProvider)
+	}
+	if !strings.ContainsAny(content, ":,\n") {
+		return []NamespaceKey{{ID: DefaultKeyID, Key: content}}, nil
+	}
+	return parseNamespaceKeys(strings.ReplaceAll(content, "\n", ","))
+}
+
+// parseKeyProvider env:NAME、file:/path/to/key、cmd:/path/to/helper args...
+func parseKeyProvider(spec string) (KeyProvider, error) {
+	kv := strings.SplitN(spec, ":", 2)
+	if len(kv) != 2 || len(strings.TrimSpace(kv[1])) == 0 {
+		return nil, fmt.Errorf("%w: key provider should be env:NAME, file:PATH or cmd:COMMAND ", ErrKeyProvider)
+	}
+	value := strings.TrimSpace(kv[1])
+
+	switch kv[0] {
+	case "env":
+		return NewEnvKeyProvider(value), nil
+	case "file":
+		return NewFileKeyProvider(value), nil
+	case "cmd":
+		args := strings.Fields(value)
+		return NewCommandKeyProvider(args[0], args[1:]...), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown key provider %s ", ErrKeyProvider, kv[0])
+	}
+}
+
+// WithKeyProvider 从 KeyProvider 获取命名空间密钥，优先于 MetaConfig 中的密钥
+func WithKeyProvider(provider KeyProvider) Option {
+	return optionFunc(func(v *Sail) {
+		v.keyProvider = provider
+	})
+}
+
+// EnvKeyProvider 从环境变量中读取密钥，每次都重新读取
+type EnvKeyProvider struct {
+	name string
+}
+
+func NewEnvKeyProvider(name string) *EnvKeyProvider {
+	return &EnvKeyProvider{name: name}
+}
+
+func (p *EnvKeyProvider) Keys() ([]NamespaceKey, error) {
+	keys, err := parseKeyContent(os.Getenv(p.name))
+	if err != nil {
+		return nil, fmt.Errorf("read key from env %s err: %w ", p.name, err)
+	}
+	return keys, nil
+}
+
+// FileKeyProvider 从文件中读取密钥，如挂载的 Secret 文件
+// 文件的修改时间或大小变化时重新读取
+type FileKeyProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	keys    []NamespaceKey
+}
+
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{path: path}
+}
+
+func (p *FileKeyProvider) Keys() ([]NamespaceKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("stat key file err: %w ", err)
+	}
+	if p.keys != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.keys, nil
+	}
+
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file err: %w ", err)
+	}
+	keys, err := parseKeyContent(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("read key from file %s err: %w ", p.path, err)
+	}
+	p.keys, p.modTime, p.size = keys, info.ModTime(), info.Size()
+	return keys, nil
+}
+
+// commandKeyTTL 命令输出的缓存时间，过期后重新执行命令
+var commandKeyTTL = time.Minute
+
+const commandKeyTimeout = 10 * time.Second
+
+// CommandKeyProvider 执行本地命令，以标准输出作为密钥，不经过 shell
+type CommandKeyProvider struct {
+	name string
+	args []string
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	keys     []NamespaceKey
+}
+
+func NewCommandKeyProvider(name string, args ...string) *CommandKeyProvider {
+	return &CommandKeyProvider{name: name, args: args}
+}
+
+func (p *CommandKeyProvider) Keys() ([]NamespaceKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && time.Since(p.loadedAt) < commandKeyTTL {
+		return p.keys, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandKeyTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, p.name, p.args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("run key command %s err: %w ", p.name, err)
+	}
+	keys, err := parseKeyContent(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("read key from command %s err: %w ", p.name, err)
+	}
+	p.keys, p.loadedAt = keys, time.Now()
+	return keys, nil
+}
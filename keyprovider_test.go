@@ -0,0 +1,176 @@
+package sail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseKeyContent(t *testing.T) {
+	keys, err := parseKeyContent(testNamespaceKey + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: DefaultKeyID, Key: testNamespaceKey}}, keys)
+
+	keys, err = parseKeyContent("k2:new-key\nk1:old-key\n")
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: "k2", Key: "new-key"}, {ID: "k1", Key: "old-key"}}, keys)
+
+	_, err = parseKeyContent("  \n")
+	assert.ErrorIs(t, err, ErrKeyProvider)
+}
+
+func Test_parseKeyProvider(t *testing.T) {
+	p, err := parseKeyProvider("env:SAIL_TEST_KEY")
+	require.NoError(t, err)
+	assert.IsType(t, &EnvKeyProvider{}, p)
+
+	p, err = parseKeyProvider("file:/run/secrets/sail_key")
+	require.NoError(t, err)
+	assert.IsType(t, &FileKeyProvider{}, p)
+
+	p, err = parseKeyProvider("cmd:/usr/local/bin/sail-key --namespace dev")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--namespace", "dev"}, p.(*CommandKeyProvider).args)
+
+	for _, spec := range []string{"vault:secret/sail", "file:", "env"} {
+		_, err = parseKeyProvider(spec)
+		assert.ErrorIs(t, err, ErrKeyProvider, spec)
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	os.Setenv("SAIL_TEST_KEY", "k1:old-key")
+	defer os.Unsetenv("SAIL_TEST_KEY")
+
+	keys, err := NewEnvKeyProvider("SAIL_TEST_KEY").Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: "k1", Key: "old-key"}}, keys)
+
+	_, err = NewEnvKeyProvider("SAIL_TEST_KEY_NOT_EXIST").Keys()
+	assert.Error(t, err)
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "sail_key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("k1:old-key"), 0600))
+
+	p := NewFileKeyProvider(keyFile)
+	keys, err := p.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: "k1", Key: "old-key"}}, keys)
+
+	// 文件变更后重新读取
+	require.NoError(t, os.WriteFile(keyFile, []byte("k2:new-key\nk1:old-key"), 0600))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	keys, err = p.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: "k2", Key: "new-key"}, {ID: "k1", Key: "old-key"}}, keys)
+
+	require.NoError(t, os.Remove(keyFile))
+	_, err = p.Keys()
+	assert.Error(t, err)
+}
+
+func TestCommandKeyProvider(t *testing.T) {
+	keys, err := NewCommandKeyProvider("echo", "k1:old-key").Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []NamespaceKey{{ID: "k1", Key: "old-key"}}, keys)
+
+	_, err = NewCommandKeyProvider("false").Keys()
+	assert.Error(t, err)
+}
+
+func TestSail_WithKeyProvider(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "sail_key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(testNamespaceKey), 0600))
+
+	encrypted, err := EncryptConfigContent("database=\"127.0.0.1:3306\"", testNamespaceKey)
+	require.NoError(t, err)
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", encrypted)
+
+	sail := New(&MetaConfig{
+		LogLevel:    "DEBUG",
+		ProjectKey:  "test_project_key",
+		Namespace:   "test",
+		Configs:     "mysql.toml",
+		KeyProvider: "file:" + keyFile,
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+	assert.Equal(t, map[string][]string{DefaultKeyID: {"mysql.toml"}}, sail.KeysInUse())
+}
+
+type countingKeyProvider struct {
+	calls int32
+	err   error
+}
+
+func (p *countingKeyProvider) Keys() ([]NamespaceKey, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []NamespaceKey{{ID: DefaultKeyID, Key: testNamespaceKey}}, nil
+}
+
+func TestSail_keyProviderOncePerPull(t *testing.T) {
+	src := NewMemorySource()
+	for _, e := range []string{"app.toml", "mysql.toml", "redis.toml"} {
+		encrypted, err := EncryptConfigContent("name=\""+e+"\"", testNamespaceKey)
+		require.NoError(t, err)
+		src.Put("/conf/test_project_key/test/"+e, encrypted)
+	}
+	newSail := func(t *testing.T, provider KeyProvider) *Sail {
+		sail := New(&MetaConfig{
+			LogLevel:   "DEBUG",
+			ProjectKey: "test_project_key",
+			Namespace:  "test",
+			Configs:    "app.toml,mysql.toml,redis.toml",
+		}, WithSource(src), WithKeyProvider(provider))
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		return sail
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		provider := &countingKeyProvider{}
+		sail := newSail(t, provider)
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&provider.calls))
+		assert.Len(t, sail.KeysInUse()[DefaultKeyID], 3)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		provider := &countingKeyProvider{err: errors.New("command timeout")}
+		sail := newSail(t, provider)
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&provider.calls))
+		assert.Len(t, sail.DecryptErrors(), 3)
+
+		// 失败后一段时间内不再调用
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&provider.calls))
+
+		// 过了退避时间后重新获取
+		sail.keyLock.Lock()
+		sail.keyFailAt = time.Now().Add(-keyProviderBackoff)
+		sail.keyLock.Unlock()
+		provider.err = nil
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Equal(t, int32(2), atomic.LoadInt32(&provider.calls))
+		assert.Empty(t, sail.DecryptErrors())
+	})
+}
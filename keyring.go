@@ -0,0 +1,121 @@
+package sail
+
+import (
+	"sort"
+	"time"
+)
+
+// keyProviderBackoff KeyProvider 获取密钥失败后，这段时间内不再调用，只使用静态配置的密钥
+var keyProviderBackoff = 30 * time.Second
+
+// WithNamespaceKeys 追加命名空间密钥，排在 NamespaceKeys 和 NamespaceKey 之前
+// 轮换密钥的步骤：
+// 1. 所有实例加上新密钥：WithNamespaceKeys(NamespaceKey{ID: "k2", Key: "new"}, NamespaceKey{ID: "k1", Key: "old"})
+// 2. 服务端用 k2 重新加密所有配置
+// 3. KeysInUse 中不再出现 k1 后，移除旧密钥
+func WithNamespaceKeys(keys ...NamespaceKey) Option {
+	return optionFunc(func(v *Sail) {
+		v.keys = append(v.keys, keys...)
+	})
+}
+
+// buildKeyring 按 选项、NamespaceKeys、NamespaceKey、BackupKey 的顺序组成密钥环
+func buildKeyring(meta *MetaConfig, optionKeys []NamespaceKey) []NamespaceKey {
+	metaKeys, _ := parseNamespaceKeys(meta.NamespaceKeys)
+
+	var defaultKey []NamespaceKey
+	if len(meta.NamespaceKey) > 0 {
+		defaultKey = append(defaultKey, NamespaceKey{ID: DefaultKeyID, Key: meta.NamespaceKey})
+	}
+	if len(meta.BackupKey) > 0 {
+		// 用于读取加密的备份文件
+		defaultKey = append(defaultKey, NamespaceKey{ID: BackupKeyID, Key: meta.BackupKey})
+	}
+	return mergeKeys(optionKeys, metaKeys, defaultKey)
+}
+
+// mergeKeys 按顺序合并密钥，重复的 ID 只保留第一个
+func mergeKeys(lists ...[]NamespaceKey) []NamespaceKey {
+	seen := make(map[string]bool)
+	result := make([]NamespaceKey, 0)
+	for _, keys := range lists {
+		for _, e := range keys {
+			if len(e.Key) == 0 || seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// keyring 当前的密钥环，KeyProvider 中的密钥排在最前，获取失败时只使用静态配置的密钥
+// KeyProvider 可能很慢（如执行命令），每次拉取或 watch 事件只获取一次，且不能持有 s.lock
+func (s *Sail) keyring() []NamespaceKey {
+	if s.keyProvider == nil {
+		return s.keys
+	}
+	s.keyLock.Lock()
+	failAt := s.keyFailAt
+	s.keyLock.Unlock()
+	if !failAt.IsZero() && time.Since(failAt) < keyProviderBackoff {
+		return s.keys
+	}
+
+	provided, err := s.keyProvider.Keys()
+	s.keyLock.Lock()
+	if err != nil {
+		s.keyFailAt = time.Now()
+	} else {
+		s.keyFailAt = time.Time{}
+	}
+	s.keyLock.Unlock()
+	if err != nil {
+		s.l.Error("get namespace keys from provider fail, retry later. ", "err", err, "backoff", keyProviderBackoff)
+		return s.keys
+	}
+	return mergeKeys(provided, s.keys)
+}
+
+// markKeyUsage 记录配置解密所用的密钥，keyID 为空代表未加密或已删除
+func (s *Sail) markKeyUsage(configFileKey, keyID string) {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	delete(s.keyUsage, configFileKey)
+	if len(keyID) > 0 {
+		s.keyUsage[configFileKey] = map[string]struct{}{keyID: {}}
+	}
+}
+
+// addKeyUsage 追加配置中加密字段所用的密钥
+func (s *Sail) addKeyUsage(configFileKey string, keyIDs ...string) {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	for _, e := range keyIDs {
+		if s.keyUsage[configFileKey] == nil {
+			s.keyUsage[configFileKey] = make(map[string]struct{})
+		}
+		s.keyUsage[configFileKey][e] = struct{}{}
+	}
+}
+
+// KeysInUse 当前配置所用的密钥 ID -> 使用该密钥的配置文件（已排序）
+// 未加密的配置不会出现，可以据此判断旧密钥是否可以下线
+func (s *Sail) KeysInUse() map[string][]string {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	result := make(map[string][]string)
+	for configFileKey, keyIDs := range s.keyUsage {
+		for keyID := range keyIDs {
+			result[keyID] = append(result[keyID], configFileKey)
+		}
+	}
+	for _, e := range result {
+		sort.Strings(e)
+	}
+	return result
+}
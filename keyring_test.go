@@ -0,0 +1,105 @@
+package sail
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_decryptWithKeys(t *testing.T) {
+	oldKey := NamespaceKey{ID: "k1", Key: testNamespaceKey}
+	newKey := NamespaceKey{ID: "k2", Key: "NEW_NAMESPACE_KEY"}
+	keys := []NamespaceKey{newKey, oldKey}
+
+	withID, err := EncryptConfigContentWithKey("host=0.0.0.0", oldKey)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(withID, "SAILENC:v2:aes-256-gcm:k1:"))
+
+	withoutID, err := EncryptConfigContent("host=0.0.0.0", oldKey.Key)
+	require.NoError(t, err)
+
+	plain, keyID, err := decryptWithKeys(withID, keys, false)
+	require.NoError(t, err)
+	assert.Equal(t, "host=0.0.0.0", plain)
+	assert.Equal(t, "k1", keyID)
+
+	// 没有密钥 ID 时按顺序尝试
+	plain, keyID, err = decryptWithKeys(withoutID, keys, false)
+	require.NoError(t, err)
+	assert.Equal(t, "host=0.0.0.0", plain)
+	assert.Equal(t, "k1", keyID)
+
+	_, _, err = decryptWithKeys(withID, []NamespaceKey{newKey}, false)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	// 密钥 ID 参与认证，不能被替换
+	swapped := strings.Replace(withID, ":k1:", ":k2:", 1)
+	_, _, err = decryptWithKeys(swapped, []NamespaceKey{{ID: "k2", Key: oldKey.Key}}, false)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	plain, keyID, err = decryptWithKeys("host=0.0.0.0", keys, false)
+	require.NoError(t, err)
+	assert.Equal(t, "host=0.0.0.0", plain)
+	assert.Equal(t, "", keyID)
+}
+
+func Test_buildKeyring(t *testing.T) {
+	keys := buildKeyring(&MetaConfig{
+		NamespaceKey:  "default-key",
+		NamespaceKeys: "k2:new-key, k1:old-key",
+	}, []NamespaceKey{{ID: "k3", Key: "newest-key"}, {ID: "k2", Key: "dup-key"}})
+
+	assert.Equal(t, []NamespaceKey{
+		{ID: "k3", Key: "newest-key"},
+		{ID: "k2", Key: "dup-key"},
+		{ID: "k1", Key: "old-key"},
+		{ID: DefaultKeyID, Key: "default-key"},
+	}, keys)
+
+	err := (&MetaConfig{
+		ETCDEndpoints: "0.0.0.0:2379",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+		NamespaceKeys: "k1",
+	}).valid(true, false)
+	assert.Error(t, err)
+}
+
+func TestSail_KeysInUse(t *testing.T) {
+	oldKey := NamespaceKey{ID: "k1", Key: testNamespaceKey}
+	newKey := NamespaceKey{ID: "k2", Key: "NEW_NAMESPACE_KEY"}
+	encrypt := func(content string, key NamespaceKey) string {
+		encrypted, err := EncryptConfigContentWithKey(content, key)
+		require.NoError(t, err)
+		return encrypted
+	}
+
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", encrypt("database=\"127.0.0.1:3306\"", oldKey))
+	src.Put("/conf/test_project_key/test/redis.yaml", encrypt("host: 0.0.0.0", oldKey))
+	src.Put("/conf/test_project_key/test/app.json", `{"name": "app"}`)
+
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "app.json,mysql.toml,redis.yaml",
+	}, WithSource(src), WithNamespaceKeys(newKey, oldKey))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, map[string][]string{"k1": {"mysql.toml", "redis.yaml"}}, sail.KeysInUse())
+
+	// 服务端用新密钥重新加密
+	src.Put("/conf/test_project_key/test/mysql.toml", encrypt("database=\"0.0.0.0:3306\"", newKey))
+	src.Delete("/conf/test_project_key/test/redis.yaml")
+	assert.Eventually(t, func() bool {
+		inUse := sail.KeysInUse()
+		return len(inUse) == 1 && len(inUse["k2"]) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "0.0.0.0:3306", sail.MustGetString("database"))
+}
@@ -2,6 +2,7 @@ package sail
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,38 +23,86 @@ func (s *Sail) readLocalFileConfig() error {
 		configFiles = []string{MergeConfigName}
 	}
 
-	s.lock.Lock()
+	keys := s.keyring()
+	vipers := make(map[string]*viper.Viper, len(configFiles))
+	raws := make(map[string][]byte, len(configFiles))
 	for _, e := range configFiles {
-		viperFile := viper.New()
-		fileSp := strings.Split(e, ".")
-		if len(fileSp) != 2 {
+		if len(strings.Split(e, ".")) != 2 {
 			continue
 		}
-		ext := fileSp[1]
-		fileContent, err := os.ReadFile(filepath.Join(s.metaConfig.ConfigFilePath, e))
-		if err != nil {
-			return fmt.Errorf("can't read local file: %s with unknow err: %w ", e, err)
+		viperFile, raw, err := s.readLocalConfigFile(e, keys)
+		var derr *DecryptError
+		if errors.As(err, &derr) {
+			s.l.Error("decrypt local config fail, skip it. ", "key", e, "err", derr.Err)
+			continue
 		}
-		fContent := string(fileContent)
-
-		if c := s.tryDecryptConfigContent(e, fContent); len(c) > 0 {
-			fContent = c
-		} else {
+		if errors.Is(err, ErrBackupCorrupted) {
+			s.l.Error("local config file is corrupted, skip it. ", "key", e, "err", err)
+			s.reportError(err)
 			continue
 		}
-
-		if ext == "custom" {
-			// viper 不支持的格式，就以文件名：文件内容形式塞到viper
-			viperFile.Set(e, fContent)
-		} else {
-			viperFile.SetConfigType(ext)
-			err = viperFile.ReadConfig(bytes.NewBufferString(fContent))
-			if err != nil {
-				return fmt.Errorf("can't read local file: %s with unknow err: %w ", e, err)
-			}
+		if err != nil {
+			return err
 		}
-		s.vipers[e] = viperFile
+		vipers[e] = viperFile
+		raws[e] = raw
+	}
+
+	s.lock.Lock()
+	for k, v := range vipers {
+		s.vipers[k] = v
+		s.raws[k] = raws[k]
+		s.revisions[k] = s.fm.manifestRevision(k)
+		s.origins[k] = OriginLocal
 	}
 	s.lock.Unlock()
+
+	for k := range vipers {
+		// 备份文件的写入时间即收到该版本的时间
+		if writtenAt := s.fm.manifestWrittenAt(k); !writtenAt.IsZero() {
+			s.metrics.SetConfigUpdated(k, writtenAt)
+		}
+	}
+	for _, e := range configFiles {
+		s.refreshBindings(e)
+	}
 	return nil
 }
+
+// readLocalConfigFile 读取并解密单个本地配置文件，同时返回解密后的原始内容，解密失败时返回 *DecryptError
+func (s *Sail) readLocalConfigFile(fileName string, keys []NamespaceKey) (*viper.Viper, []byte, error) {
+	fileContent, err := os.ReadFile(filepath.Join(s.metaConfig.ConfigFilePath, fileName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read local file: %s with unknow err: %w ", fileName, err)
+	}
+	if err := s.fm.verifyConfigFile(fileName, fileContent); err != nil {
+		return nil, nil, err
+	}
+	return s.newLocalViper(fileName, fileContent, keys)
+}
+
+// newLocalViper 解密并解析本地保存的配置内容，如备份文件、历史版本
+func (s *Sail) newLocalViper(fileName string, fileContent []byte, keys []NamespaceKey) (*viper.Viper, []byte, error) {
+	viperFile := viper.New()
+	ext := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	fContent, err := s.decryptConfig(fileName, string(fileContent), keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ext == "custom" {
+		// viper 不支持的格式，就以文件名：文件内容形式塞到viper
+		viperFile.Set(fileName, fContent)
+		return viperFile, []byte(fContent), nil
+	}
+
+	viperFile.SetConfigType(ext)
+	err = viperFile.ReadConfig(bytes.NewBufferString(fContent))
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read local file: %s with unknow err: %w ", fileName, err)
+	}
+	if err := s.decryptConfigFields(fileName, viperFile, keys); err != nil {
+		return nil, nil, err
+	}
+	return viperFile, []byte(fContent), nil
+}
@@ -0,0 +1,63 @@
+package sail
+
+import "context"
+
+// WithLocalFirst 启动时先同步加载本地备份文件，Pull 立即返回，再在后台连接配置来源
+// 拉取到的新版本配置会像 watch 到的变更一样通知，需要最新配置时调用 WaitSynced
+// 本地没有可用的备份文件时，Pull 和默认模式一样阻塞拉取
+func WithLocalFirst(localFirst bool) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.LocalFirst = localFirst
+	})
+}
+
+// WaitSynced 等待第一次从配置来源拉取配置成功
+func (s *Sail) WaitSynced(ctx context.Context) error {
+	select {
+	case <-s.synced:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Synced 是否已经从配置来源拉取过配置
+func (s *Sail) Synced() bool {
+	select {
+	case <-s.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Sail) markSynced() {
+	s.syncOnce.Do(func() {
+		close(s.synced)
+	})
+}
+
+// pullLocalFirst 加载本地备份文件并在后台同步，本地没有可用的配置时返回 false
+func (s *Sail) pullLocalFirst() bool {
+	if len(s.metaConfig.ConfigFilePath) == 0 {
+		return false
+	}
+	if err := s.readLocalFileConfig(); err != nil {
+		s.l.Warn("read local file fail, pull from remote. ", "err", err)
+		return false
+	}
+	s.lock.RLock()
+	loaded := len(s.vipers)
+	s.lock.RUnlock()
+	if loaded == 0 {
+		return false
+	}
+
+	go func() {
+		if err := s.connectAndPull(); err != nil {
+			s.l.Warn("sync config fail, retry in background. ", "err", err)
+			s.reconnectEtcd()
+		}
+	}()
+	return true
+}
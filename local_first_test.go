@@ -0,0 +1,141 @@
+package sail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSource List 在 release 关闭前阻塞
+type blockingSource struct {
+	*MemorySource
+	release chan struct{}
+}
+
+func (b *blockingSource) List(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	return b.MemorySource.List(ctx, prefix)
+}
+
+func TestSail_LocalFirst(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("database=\"local\""), 0644))
+
+	src := &blockingSource{MemorySource: NewMemorySource(), release: make(chan struct{})}
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+
+	var mu sync.Mutex
+	var changed []string
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src), WithLocalFirst(true), WithOnConfigChange(func(configFileKey string, s *Sail) {
+		mu.Lock()
+		defer mu.Unlock()
+		changed = append(changed, configFileKey)
+	}))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, "local", sail.MustGetString("database"))
+	assert.False(t, sail.Synced())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sail.WaitSynced(ctx), context.DeadlineExceeded)
+
+	close(src.release)
+	require.NoError(t, sail.WaitSynced(context.Background()))
+	assert.Equal(t, "remote", sail.MustGetString("database"))
+	assert.Equal(t, OriginRemote, sail.ConfigOrigins()["mysql.toml"])
+	mu.Lock()
+	assert.Equal(t, []string{"/conf/test_project_key/test/mysql.toml"}, changed)
+	mu.Unlock()
+}
+
+func TestSail_restartWithMergeConfig(t *testing.T) {
+	assertMerged := func(t *testing.T, dir string) {
+		v := viper.New()
+		v.SetConfigFile(filepath.Join(dir, MergeConfigName))
+		require.NoError(t, v.ReadInConfig())
+		assert.Equal(t, []string{"mysql.toml.database"}, v.AllKeys())
+	}
+	newSail := func(t *testing.T, dir string, src Source, opts ...Option) *Sail {
+		sail := New(&MetaConfig{
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "mysql.toml",
+			ConfigFilePath: dir,
+			MergeConfig:    true,
+		}, append([]Option{WithSource(src), WithRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			Multiplier:     2,
+		})}, opts...)...)
+		require.NoError(t, sail.Err())
+		return sail
+	}
+
+	t.Run("LocalFirst", func(t *testing.T) {
+		dir := t.TempDir()
+		src := NewMemorySource()
+		src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+
+		for i := 0; i < 3; i++ {
+			sail := newSail(t, dir, src, WithLocalFirst(true))
+			require.NoError(t, sail.Pull())
+			require.NoError(t, sail.WaitSynced(context.Background()))
+
+			database, err := sail.GetString("database")
+			require.NoError(t, err)
+			assert.Equal(t, "remote", database)
+			assert.Equal(t, map[string]ConfigOrigin{"mysql.toml": OriginRemote}, sail.ConfigOrigins())
+			require.NoError(t, sail.Close())
+			assertMerged(t, dir)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		dir := t.TempDir()
+		src := &flakySource{MemorySource: NewMemorySource()}
+		src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+		sail := newSail(t, dir, src)
+		require.NoError(t, sail.Pull())
+		require.NoError(t, sail.Close())
+
+		for i := 0; i < 3; i++ {
+			atomic.StoreInt32(&src.down, 1)
+			sail := newSail(t, dir, src)
+			require.NoError(t, sail.Pull())
+			assert.Equal(t, map[string]ConfigOrigin{MergeConfigName: OriginLocal}, sail.ConfigOrigins())
+
+			// 重连后只保留配置来源中的配置
+			atomic.StoreInt32(&src.down, 0)
+			require.Eventually(t, func() bool {
+				return sail.Status().State == StateConnected
+			}, time.Second, time.Millisecond)
+			database, err := sail.GetString("database")
+			require.NoError(t, err)
+			assert.Equal(t, "remote", database)
+			assert.Equal(t, map[string]ConfigOrigin{"mysql.toml": OriginRemote}, sail.ConfigOrigins())
+			require.NoError(t, sail.Close())
+			assertMerged(t, dir)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package sail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestFileName 备份目录中记录每个备份文件 revision 和校验和的文件
+const ManifestFileName = ".sail-manifest.json"
+
+// tempFilePrefix 写入中的临时文件，以 . 开头，不会被当作配置文件读取
+const tempFilePrefix = ".sail-tmp-"
+
+var ErrBackupCorrupted = errors.New("ErrBackupCorrupted")
+
+// Manifest 备份目录的清单
+type Manifest struct {
+	Files map[string]*ManifestEntry `json:"files"`
+}
+
+// ManifestEntry 单个备份文件的记录，SHA256 为磁盘上（加密后）内容的校验和
+type ManifestEntry struct {
+	Revision  int64     `json:"revision"`
+	SHA256    string    `json:"sha256"`
+	WrittenAt time.Time `json:"written_at"`
+	// Pending 正在写入的版本，写入备份文件前记录，写入后成为当前记录
+	// 两步之间崩溃时，备份文件是旧版本或新版本都能通过校验
+	Pending *ManifestEntry `json:"pending,omitempty"`
+}
+
+// ReadManifest 读取 dir 中的清单，清单不存在时返回 os.ErrNotExist
+func ReadManifest(dir string) (*Manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v ", ErrBackupCorrupted, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]*ManifestEntry)
+	}
+	return manifest, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// atomicWriteFile 先写临时文件并 fsync，再 rename 覆盖，读者只会看到完整的旧文件或新文件
+func atomicWriteFile(filename string, content []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir 持久化目录项，保证 rename 在崩溃后依然可见
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func isInternalFile(fileName string) bool {
+	return strings.HasPrefix(fileName, ".")
+}
+
+// loadManifest 调用方需持有 manifestLock
+func (f *FileMaintainer) loadManifest() *Manifest {
+	if f.manifest != nil {
+		return f.manifest
+	}
+	manifest, err := ReadManifest(f.sail.metaConfig.ConfigFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			f.sail.l.Warn("read manifest fail, rebuild it. ", "err", err)
+		}
+		manifest = &Manifest{Files: make(map[string]*ManifestEntry)}
+	}
+	f.manifest = manifest
+	return manifest
+}
+
+// updateManifest entry 为 nil 时删除该文件的记录
+func (f *FileMaintainer) updateManifest(fileName string, entry *ManifestEntry) error {
+	f.manifestLock.Lock()
+	defer f.manifestLock.Unlock()
+
+	manifest := f.loadManifest()
+	if entry == nil {
+		if _, ok := manifest.Files[fileName]; !ok {
+			return nil
+		}
+		delete(manifest.Files, fileName)
+	} else {
+		manifest.Files[fileName] = entry
+	}
+	return f.saveManifest(manifest)
+}
+
+// markPending 写入备份文件前，在清单中记录新版本的校验和
+func (f *FileMaintainer) markPending(fileName string, pending *ManifestEntry) error {
+	f.manifestLock.Lock()
+	defer f.manifestLock.Unlock()
+
+	manifest := f.loadManifest()
+	entry := &ManifestEntry{}
+	if old, ok := manifest.Files[fileName]; ok {
+		*entry = *old
+	}
+	entry.Pending = pending
+	manifest.Files[fileName] = entry
+	return f.saveManifest(manifest)
+}
+
+// saveManifest 调用方需持有 manifestLock
+func (f *FileMaintainer) saveManifest(manifest *Manifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicWriteFile(filepath.Join(f.sail.metaConfig.ConfigFilePath, ManifestFileName), content, backupFilePerm)
+}
+
+// verifyConfigFile 校验备份文件
+// 没有清单（旧版本写入的备份）或清单中没有该文件的校验和时不校验
+func (f *FileMaintainer) verifyConfigFile(fileName string, content []byte) error {
+	f.manifestLock.Lock()
+	defer f.manifestLock.Unlock()
+
+	manifest := f.loadManifest()
+	entry, ok := manifest.Files[fileName]
+	if !ok {
+		return nil
+	}
+	sum := checksum(content)
+	if entry.Pending != nil && sum == entry.Pending.SHA256 {
+		// 写入备份文件后、更新清单前崩溃，备份文件已经是新版本
+		manifest.Files[fileName] = entry.Pending
+		return nil
+	}
+	if len(entry.SHA256) > 0 && sum != entry.SHA256 {
+		return fmt.Errorf("%w: %s checksum mismatch, want %s got %s ", ErrBackupCorrupted, fileName, entry.SHA256, sum)
+	}
+	return nil
+}
+
+// manifestRevision 清单中记录的 revision，没有记录时为 0
+func (f *FileMaintainer) manifestRevision(fileName string) int64 {
+	f.manifestLock.Lock()
+	defer f.manifestLock.Unlock()
+
+	if entry, ok := f.loadManifest().Files[fileName]; ok {
+		return entry.Revision
+	}
+	return 0
+}
+
+// manifestWrittenAt 清单中记录的写入时间，没有记录时为零值
+func (f *FileMaintainer) manifestWrittenAt(fileName string) time.Time {
+	f.manifestLock.Lock()
+	defer f.manifestLock.Unlock()
+
+	if entry, ok := f.loadManifest().Files[fileName]; ok {
+		return entry.WrittenAt
+	}
+	return time.Time{}
+}
+
+// tempFileExpire 超过该时间的临时文件视为崩溃时的残留
+const tempFileExpire = time.Minute
+
+// cleanTempFiles 清理崩溃时残留的临时文件，正在写入的临时文件不受影响
+func (f *FileMaintainer) cleanTempFiles(dirFiles []string) {
+	for _, e := range dirFiles {
+		if !strings.HasPrefix(e, tempFilePrefix) {
+			continue
+		}
+		fileName := filepath.Join(f.sail.metaConfig.ConfigFilePath, e)
+		info, err := os.Stat(fileName)
+		if err == nil && time.Since(info.ModTime()) > tempFileExpire {
+			_ = os.Remove(fileName)
+		}
+	}
+}
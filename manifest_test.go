@@ -0,0 +1,115 @@
+package sail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/pkg/v3/fileutil"
+)
+
+func Test_atomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "mysql.toml")
+
+	require.NoError(t, atomicWriteFile(fileName, []byte("old"), 0644))
+	require.NoError(t, atomicWriteFile(fileName, []byte("new"), 0600))
+
+	content, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	dirFiles, err := fileutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mysql.toml"}, dirFiles)
+}
+
+func TestFileMaintainer_manifest(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+	rev := src.Put("/conf/test_project_key/test/redis.toml", "host=\"0.0.0.0\"")
+
+	// 崩溃时残留的临时文件
+	staleTemp := filepath.Join(dir, tempFilePrefix+"mysql.toml-1")
+	require.NoError(t, os.WriteFile(staleTemp, []byte("half"), 0644))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(staleTemp, past, past))
+
+	meta := &MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml,redis.toml",
+		ConfigFilePath: dir,
+	}
+	sail := New(meta, WithSource(src))
+	require.NoError(t, sail.Err())
+	require.NoError(t, sail.Pull())
+
+	manifest, err := ReadManifest(dir)
+	require.NoError(t, err)
+	require.Contains(t, manifest.Files, "redis.toml")
+	assert.Equal(t, rev, manifest.Files["redis.toml"].Revision)
+	assert.Equal(t, checksum([]byte("host=\"0.0.0.0\"")), manifest.Files["redis.toml"].SHA256)
+	_, err = os.Stat(staleTemp)
+	assert.True(t, os.IsNotExist(err))
+
+	src.Delete("/conf/test_project_key/test/redis.toml")
+	assert.Eventually(t, func() bool {
+		manifest, err := ReadManifest(dir)
+		return err == nil && manifest.Files["redis.toml"] == nil
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, sail.Close())
+
+	newLocal := func(t *testing.T, onError OnError) *Sail {
+		local := New(&MetaConfig{
+			ETCDEndpoints:  "127.0.0.1:2379",
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "mysql.toml",
+			ConfigFilePath: dir,
+		}, WithOnError(onError))
+		require.NoError(t, local.Err())
+		return local
+	}
+
+	t.Run("CrashBeforeManifest", func(t *testing.T) {
+		// 模拟写入备份文件后、更新清单前崩溃
+		content := []byte("database=\"10.0.0.1:3306\"")
+		writer := newLocal(t, nil)
+		require.NoError(t, writer.fm.markPending("mysql.toml", &ManifestEntry{Revision: 99, SHA256: checksum(content), WrittenAt: time.Now()}))
+		require.NoError(t, atomicWriteFile(filepath.Join(dir, "mysql.toml"), content, backupFilePerm))
+
+		var reported error
+		local := newLocal(t, func(err error, s *Sail) {
+			reported = err
+		})
+		require.NoError(t, local.readLocalFileConfig())
+		assert.NoError(t, reported)
+		assert.Equal(t, "10.0.0.1:3306", local.MustGetString("database"))
+		assert.Equal(t, int64(99), local.fm.manifestRevision("mysql.toml"))
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("database=\"127.0"), 0644))
+
+		var reported error
+		local := newLocal(t, func(err error, s *Sail) {
+			reported = err
+		})
+		require.NoError(t, local.readLocalFileConfig())
+
+		assert.True(t, errors.Is(reported, ErrBackupCorrupted))
+		_, err := local.GetRaw("mysql.toml")
+		assert.ErrorIs(t, err, ErrConfigNotFound)
+	})
+}
@@ -0,0 +1,37 @@
+package sail
+
+import "time"
+
+// MetricsRecorder 记录客户端的运行指标，github.com/HYY-yu/sail-client/metrics 提供了 prometheus 的实现
+// 方法会在拉取、监听的协程中同步调用，实现需要并发安全且不能阻塞
+type MetricsRecorder interface {
+	// ObservePull 一次全量拉取（包括启动、重连和 revision 被压缩后的拉取）
+	ObservePull(duration time.Duration, err error)
+	// IncReconnect 一次重连尝试
+	IncReconnect(err error)
+	// IncWatchEvent 一个监听到的变更，applied 为 false 代表被忽略，如不在 Configs 内、解密失败
+	IncWatchEvent(configFileKey string, applied bool)
+	// IncDecryptFailure 一次解密失败
+	IncDecryptFailure(configFileKey string)
+	// SetConfigUpdated 配置最后一次更新的时间，零值代表配置已被删除
+	SetConfigUpdated(configFileKey string, updatedAt time.Time)
+}
+
+// WithMetrics 记录运行指标，默认不记录
+func WithMetrics(m MetricsRecorder) Option {
+	return optionFunc(func(v *Sail) {
+		v.metrics = m
+	})
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObservePull(time.Duration, error) {}
+
+func (noopMetrics) IncReconnect(error) {}
+
+func (noopMetrics) IncWatchEvent(string, bool) {}
+
+func (noopMetrics) IncDecryptFailure(string) {}
+
+func (noopMetrics) SetConfigUpdated(string, time.Time) {}
@@ -0,0 +1,145 @@
+// Package metrics 基于 prometheus 的 sail.MetricsRecorder 实现
+// 例：
+// m, err := metrics.New(prometheus.DefaultRegisterer)
+// s := sail.New(meta, sail.WithMetrics(m))
+// 同一进程内有多个 Sail 实例时，用 prometheus.WrapRegistererWith 加上区分的标签
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	sail "github.com/HYY-yu/sail-client"
+)
+
+const namespace = "sail"
+
+// Recorder 实现 sail.MetricsRecorder
+type Recorder struct {
+	pulls           *prometheus.CounterVec
+	pullDuration    prometheus.Histogram
+	reconnects      *prometheus.CounterVec
+	watchEvents     *prometheus.CounterVec
+	decryptFailures *prometheus.CounterVec
+	configAge       *configAgeCollector
+}
+
+var _ sail.MetricsRecorder = (*Recorder)(nil)
+
+// New 创建并注册所有指标
+func New(reg prometheus.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		pulls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pulls_total",
+			Help:      "Number of full config pulls, by result.",
+		}, []string{"result"}),
+		pullDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "pull_duration_seconds",
+			Help:      "Latency of full config pulls.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Number of reconnect attempts, by result.",
+		}, []string{"result"}),
+		watchEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "watch_events_total",
+			Help:      "Number of watch events, by config and whether they were applied or ignored.",
+		}, []string{"config", "result"}),
+		decryptFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decrypt_failures_total",
+			Help:      "Number of config decrypt failures, by config.",
+		}, []string{"config"}),
+		configAge: newConfigAgeCollector(),
+	}
+
+	for _, c := range []prometheus.Collector{r.pulls, r.pullDuration, r.reconnects, r.watchEvents, r.decryptFailures, r.configAge} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Recorder) ObservePull(duration time.Duration, err error) {
+	r.pulls.WithLabelValues(result(err)).Inc()
+	r.pullDuration.Observe(duration.Seconds())
+}
+
+func (r *Recorder) IncReconnect(err error) {
+	r.reconnects.WithLabelValues(result(err)).Inc()
+}
+
+func (r *Recorder) IncWatchEvent(configFileKey string, applied bool) {
+	if applied {
+		r.watchEvents.WithLabelValues(configFileKey, "applied").Inc()
+		return
+	}
+	r.watchEvents.WithLabelValues(configFileKey, "ignored").Inc()
+}
+
+func (r *Recorder) IncDecryptFailure(configFileKey string) {
+	r.decryptFailures.WithLabelValues(configFileKey).Inc()
+}
+
+func (r *Recorder) SetConfigUpdated(configFileKey string, updatedAt time.Time) {
+	r.configAge.set(configFileKey, updatedAt)
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// configAgeCollector 采集时才计算每个配置距最后一次更新的秒数
+type configAgeCollector struct {
+	desc *prometheus.Desc
+
+	mu        sync.Mutex
+	updatedAt map[string]time.Time
+}
+
+func newConfigAgeCollector() *configAgeCollector {
+	return &configAgeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "config_age_seconds"),
+			"Seconds since each config was last updated.",
+			[]string{"config"}, nil,
+		),
+		updatedAt: make(map[string]time.Time),
+	}
+}
+
+func (c *configAgeCollector) set(configFileKey string, updatedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if updatedAt.IsZero() {
+		delete(c.updatedAt, configFileKey)
+		return
+	}
+	c.updatedAt[configFileKey] = updatedAt
+}
+
+func (c *configAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *configAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range c.updatedAt {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(v).Seconds(), k)
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sail "github.com/HYY-yu/sail-client"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	require.NoError(t, err)
+	_, err = New(reg)
+	assert.Error(t, err, "duplicate registration")
+
+	src := sail.NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+	s := sail.New(&sail.MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml",
+	}, sail.WithSource(src), sail.WithMetrics(m))
+	require.NoError(t, s.Err())
+	defer s.Close()
+	require.NoError(t, s.Pull())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.pulls.WithLabelValues("success")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.configAge))
+
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"0.0.0.0:3306\"")
+	src.Put("/conf/test_project_key/test/other.toml", "name=\"other\"")
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.watchEvents.WithLabelValues("mysql.toml", "applied")) == 1 &&
+			testutil.ToFloat64(m.watchEvents.WithLabelValues("other.toml", "ignored")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	m.IncReconnect(errors.New("dial timeout"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.reconnects.WithLabelValues("error")))
+	m.IncDecryptFailure("mysql.toml")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.decryptFailures.WithLabelValues("mysql.toml")))
+
+	m.SetConfigUpdated("mysql.toml", time.Now().Add(-time.Minute))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(m.configAge), 60.0)
+	m.SetConfigUpdated("mysql.toml", time.Time{})
+	assert.Equal(t, 0, testutil.CollectAndCount(m.configAge))
+}
@@ -0,0 +1,232 @@
+package sail
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotTargeted = errors.New("ErrNotTargeted")
+)
+
+// maxPublishLookback 灰度未命中时，最多往前查找的版本数
+const maxPublishLookback = 16
+
+// WithPublishOnly 配置中心通过 PUBLISH 记录发布配置时开启
+// 配置出现过 PUBLISH 记录后，直接写入的版本都当作草稿，不开启也不会被应用；
+// 开启后配置的第一个版本也要等待 PUBLISH 记录，否则第一次灰度发布前写入的草稿会被所有实例使用
+func WithPublishOnly(publishOnly bool) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.PublishOnly = publishOnly
+	})
+}
+
+// Instance 实例标识，用于灰度发布
+type Instance struct {
+	Hostname string
+	IP       string
+	Labels   map[string]string
+}
+
+// ID 实例的唯一标识，用于百分比灰度
+func (i Instance) ID() string {
+	return i.Hostname + "/" + i.IP
+}
+
+// PublishTarget 灰度发布的目标
+// 三个条件满足其一即命中：
+// 1. Instances 中包含本实例的 Hostname 或 IP
+// 2. 本实例包含 Labels 中所有的标签，且（Percent 为 0 或按实例 hash 命中 Percent）
+// 3. Labels 为空，按实例 hash 命中 Percent
+// 所有条件均为空代表全量发布。
+type PublishTarget struct {
+	Instances []string          `json:"instances"`
+	Labels    map[string]string `json:"labels"`
+	Percent   int               `json:"percent"` // 0-100
+}
+
+func (t *PublishTarget) match(ins Instance) bool {
+	if t == nil {
+		return true
+	}
+	if len(t.Instances) == 0 && len(t.Labels) == 0 && t.Percent <= 0 {
+		return true
+	}
+
+	for _, e := range t.Instances {
+		if e == ins.Hostname || e == ins.IP {
+			return true
+		}
+	}
+
+	if len(t.Labels) == 0 && t.Percent <= 0 {
+		return false
+	}
+	for k, v := range t.Labels {
+		if ins.Labels[k] != v {
+			return false
+		}
+	}
+	if t.Percent <= 0 {
+		return true
+	}
+	return instanceBucket(ins) < t.Percent
+}
+
+// instanceBucket 把实例稳定地映射到 [0,100)，同一实例在每次发布中落在同一个桶内
+func instanceBucket(ins Instance) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ins.ID()))
+	return int(h.Sum32() % 100)
+}
+
+// publishRecord PUBLISH&{token}&{publish_type}&{reversion}&{data}
+// data 为 base64 编码的 PublishTarget JSON 时，代表灰度发布。
+type publishRecord struct {
+	Token       string
+	PublishType string
+	Reversion   int
+	Data        string
+	Target      *PublishTarget
+}
+
+func parsePublish(etcdValue []byte) (*publishRecord, bool) {
+	etcdValueStr := string(etcdValue)
+	if !strings.HasPrefix(etcdValueStr, "PUBLISH") {
+		return nil, false
+	}
+
+	publishStrArr := strings.Split(etcdValueStr, "&")
+	if len(publishStrArr) != 5 {
+		return nil, false
+	}
+
+	reversion, _ := strconv.Atoi(publishStrArr[3])
+	record := &publishRecord{
+		Token:       publishStrArr[1],
+		PublishType: publishStrArr[2],
+		Reversion:   reversion,
+		Data:        publishStrArr[4],
+	}
+
+	// data 不是灰度目标时，按全量发布处理
+	if targetJSON, err := base64.StdEncoding.DecodeString(record.Data); err == nil {
+		target := &PublishTarget{}
+		if err := json.Unmarshal(targetJSON, target); err == nil {
+			record.Target = target
+		}
+	}
+	return record, true
+}
+
+// resolvePublish 如果是 PUBLISH 记录，则返回它指向的版本的配置内容，否则原样返回
+// 本实例不在灰度范围内时，返回 ErrNotTargeted
+func (s *Sail) resolvePublish(kv *KeyValue) ([]byte, error) {
+	record, isPublish := parsePublish(kv.Value)
+	if !isPublish {
+		return kv.Value, nil
+	}
+	if !record.Target.match(s.instance) {
+		return nil, fmt.Errorf("%w: %s at reversion %d ", ErrNotTargeted, kv.Key, kv.ModRevision)
+	}
+	return s.readFromReversion(kv.Key, int64(record.Reversion))
+}
+
+// resolveTargetedRelease 往前找到本实例应使用的版本，同时返回该配置是否出现过 PUBLISH 记录
+// 出现过 PUBLISH 记录时，直接写入的版本都是草稿，只使用命中本实例的 PUBLISH 记录，与 watch 的处理一致
+func (s *Sail) resolveTargetedRelease(kv *KeyValue) ([]byte, bool, error) {
+	key := kv.Key
+	// 往前都没有 PUBLISH 记录时，使用最新直接写入的版本
+	var latest []byte
+	hasLatest := false
+	published := false
+
+	for i := 0; i < maxPublishLookback; i++ {
+		if _, isPublish := parsePublish(kv.Value); isPublish {
+			published = true
+			value, err := s.resolvePublish(kv)
+			if !errors.Is(err, ErrNotTargeted) {
+				return value, true, err
+			}
+		} else if !hasLatest {
+			latest, hasLatest = kv.Value, true
+		}
+
+		if kv.ModRevision <= 1 {
+			break
+		}
+		prev, err := s.source.Get(s.ctx, key, kv.ModRevision-1)
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrSourceCompacted) {
+			// 已经是该配置的第一个版本，或者更早的版本已被压缩
+			break
+		}
+		if err != nil {
+			return nil, published, err
+		}
+		kv = prev
+	}
+	if !published && hasLatest && !s.metaConfig.PublishOnly {
+		return latest, false, nil
+	}
+	return nil, published, fmt.Errorf("%w: can't find a release for this instance: %s ", ErrNotTargeted, key)
+}
+
+// isPublished 配置是否出现过 PUBLISH 记录
+func (s *Sail) isPublished(configFileKey string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.published[configFileKey]
+}
+
+func (s *Sail) setPublished(configFileKey string, published bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if published {
+		s.published[configFileKey] = true
+		return
+	}
+	delete(s.published, configFileKey)
+}
+
+func newInstance(meta *MetaConfig) Instance {
+	ins := Instance{
+		Labels: parseInstanceLabels(meta.InstanceLabels),
+	}
+	ins.Hostname, _ = os.Hostname()
+	ins.IP = localIP()
+	return ins
+}
+
+// parseInstanceLabels k1=v1,k2=v2
+func parseInstanceLabels(labels string) map[string]string {
+	result := make(map[string]string)
+	for _, e := range strings.Split(labels, ",") {
+		kv := strings.SplitN(strings.TrimSpace(e), "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			continue
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result
+}
+
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, e := range addrs {
+		ipNet, ok := e.(*net.IPNet)
+		if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
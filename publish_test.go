@@ -0,0 +1,226 @@
+package sail
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func publishValue(reversion string, target string) []byte {
+	return []byte("PUBLISH&THIS_IS_TOKEN&2&" + reversion + "&" + base64.StdEncoding.EncodeToString([]byte(target)))
+}
+
+func Test_parsePublish(t *testing.T) {
+	record, ok := parsePublish([]byte("PUBLISH&THIS_IS_TOKEN&1&22&SecretData=="))
+	require.Equal(t, true, ok)
+	assert.Equal(t, 22, record.Reversion)
+	assert.Nil(t, record.Target)
+
+	record, ok = parsePublish(publishValue("23", `{"instances":["pod-1"],"percent":10}`))
+	require.Equal(t, true, ok)
+	assert.Equal(t, 23, record.Reversion)
+	assert.Equal(t, &PublishTarget{Instances: []string{"pod-1"}, Percent: 10}, record.Target)
+
+	_, ok = parsePublish([]byte("database=\"127.0.0.1:3306\""))
+	assert.Equal(t, false, ok)
+}
+
+func TestPublishTarget_match(t *testing.T) {
+	ins := Instance{
+		Hostname: "pod-1",
+		IP:       "10.0.0.1",
+		Labels:   map[string]string{"zone": "a"},
+	}
+	tests := []struct {
+		name   string
+		target *PublishTarget
+		want   bool
+	}{
+		{name: "full", target: nil, want: true},
+		{name: "empty", target: &PublishTarget{}, want: true},
+		{name: "hostname", target: &PublishTarget{Instances: []string{"pod-1"}}, want: true},
+		{name: "ip", target: &PublishTarget{Instances: []string{"10.0.0.1"}}, want: true},
+		{name: "otherInstance", target: &PublishTarget{Instances: []string{"pod-2"}}, want: false},
+		{name: "labels", target: &PublishTarget{Labels: map[string]string{"zone": "a"}}, want: true},
+		{name: "otherLabels", target: &PublishTarget{Labels: map[string]string{"zone": "b"}}, want: false},
+		{name: "percent100", target: &PublishTarget{Percent: 100}, want: true},
+		{name: "percentBucket", target: &PublishTarget{Percent: instanceBucket(ins)}, want: false},
+		{name: "percentBucket+1", target: &PublishTarget{Percent: instanceBucket(ins) + 1}, want: true},
+		{name: "labelsAndPercent", target: &PublishTarget{Labels: map[string]string{"zone": "b"}, Percent: 100}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.target.match(ins))
+		})
+	}
+}
+
+func TestSail_resolveTargetedRelease(t *testing.T) {
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		LogLevel:      "DEBUG",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+	}, WithInstance(Instance{Hostname: "pod-1", IP: "10.0.0.1"}))
+	sail.etcdClient = &clientv3.Client{
+		KV: &mockRevKV{KV: clientv3.NewKVFromKVClient(nil, nil), values: map[int64]string{
+			2: "database=\"release-1\"",
+			3: string(publishValue("2", `{}`)),
+			5: "database=\"release-2\"",
+			6: string(publishValue("5", `{"instances":["pod-2"]}`)),
+			8: "database=\"release-3\"",
+			9: string(publishValue("8", `{"instances":["pod-1"]}`)),
+		}},
+	}
+	key := "/conf/test_project_key/test/mysql.toml"
+
+	// 命中灰度
+	value, published, err := sail.resolveTargetedRelease(&KeyValue{Key: key, Value: publishValue("8", `{"instances":["pod-1"]}`), ModRevision: 9})
+	require.NoError(t, err)
+	assert.Equal(t, true, published)
+	assert.Equal(t, "database=\"release-3\"", string(value))
+
+	// 未命中灰度，使用上一次的发布
+	value, _, err = sail.resolveTargetedRelease(&KeyValue{Key: key, Value: publishValue("5", `{"instances":["pod-2"]}`), ModRevision: 6})
+	require.NoError(t, err)
+	assert.Equal(t, "database=\"release-1\"", string(value))
+
+	// 出现过 PUBLISH 记录后，直接写入的版本是草稿
+	value, published, err = sail.resolveTargetedRelease(&KeyValue{Key: key, Value: []byte("database=\"release-3\""), ModRevision: 8})
+	require.NoError(t, err)
+	assert.Equal(t, true, published)
+	assert.Equal(t, "database=\"release-1\"", string(value))
+
+	// 没有 PUBLISH 记录时直接使用
+	value, published, err = sail.resolveTargetedRelease(&KeyValue{Key: key, Value: []byte("database=\"release-1\""), ModRevision: 2})
+	require.NoError(t, err)
+	assert.Equal(t, false, published)
+	assert.Equal(t, "database=\"release-1\"", string(value))
+
+	// 监听时未命中灰度，直接跳过
+	_, err = sail.resolvePublish(&KeyValue{Key: key, Value: publishValue("5", `{"instances":["pod-2"]}`), ModRevision: 6})
+	assert.ErrorIs(t, err, ErrNotTargeted)
+}
+
+func TestSail_PublishOnly(t *testing.T) {
+	key := "/conf/test_project_key/test/mysql.toml"
+	src := NewMemorySource()
+	release := src.Put(key, "database=\"release-1\"")
+	src.Put(key, string(publishValue(strconv.FormatInt(release, 10), `{}`)))
+
+	newSail := func(t *testing.T, hostname string) *etcdWatcher {
+		sail := New(&MetaConfig{
+			LogLevel:   "DEBUG",
+			ProjectKey: "test_project_key",
+			Namespace:  "test",
+			Configs:    "mysql.toml",
+		}, WithSource(src), WithPublishOnly(true), WithInstance(Instance{Hostname: hostname, IP: "10.0.0.1"}))
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		require.NoError(t, sail.pullETCDConfig())
+		assert.Equal(t, "release-1", sail.MustGetString("database"))
+		return NewWatcher(sail.ctx, sail).(*etcdWatcher)
+	}
+	pod1 := newSail(t, "pod-1")
+	pod2 := newSail(t, "pod-2")
+
+	// 草稿不会被任何实例应用
+	draft := src.Put(key, "database=\"release-2\"")
+	draftKV, err := src.Get(context.Background(), key, draft)
+	require.NoError(t, err)
+	for _, ee := range []*etcdWatcher{pod1, pod2} {
+		applied, err := ee.dealETCDPut(draftKV)
+		require.NoError(t, err)
+		assert.Equal(t, false, applied)
+		assert.Equal(t, "release-1", ee.s.MustGetString("database"))
+	}
+
+	// 灰度发布只有 pod-1 命中
+	publish := src.Put(key, string(publishValue(strconv.FormatInt(draft, 10), `{"instances":["pod-1"]}`)))
+	publishKV, err := src.Get(context.Background(), key, publish)
+	require.NoError(t, err)
+	_, err = pod1.dealETCDPut(publishKV)
+	require.NoError(t, err)
+	assert.Equal(t, "release-2", pod1.s.MustGetString("database"))
+	_, err = pod2.dealETCDPut(publishKV)
+	require.NoError(t, err)
+	assert.Equal(t, "release-1", pod2.s.MustGetString("database"))
+
+	// 重启时同样跳过草稿和未命中的灰度
+	src.Put(key, "database=\"release-3\"")
+	newSail(t, "pod-2")
+}
+
+func TestSail_publishNotTargeted(t *testing.T) {
+	src := NewMemorySource()
+	key := "/conf/test_project_key/test/mysql.toml"
+	// 第一次发布就是灰度，pod-2 没有可用的版本
+	release := src.Put(key, "database=\"release-1\"")
+	src.Put(key, string(publishValue(strconv.FormatInt(release, 10), `{"instances":["pod-1"]}`)))
+	src.Put("/conf/test_project_key/test/other.toml", "name=\"other\"")
+
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml,other.toml",
+	}, WithSource(src), WithInstance(Instance{Hostname: "pod-2", IP: "10.0.0.2"}))
+	require.NoError(t, sail.Err())
+	t.Cleanup(func() {
+		_ = sail.Close()
+	})
+
+	require.NoError(t, sail.Pull())
+	assert.Equal(t, "other", sail.MustGetString("name"))
+	assert.Nil(t, sail.GetViperWithName("mysql.toml"))
+}
+
+func TestSail_publishDraft(t *testing.T) {
+	key := "/conf/test_project_key/test/mysql.toml"
+	src := NewMemorySource()
+	release := src.Put(key, "database=\"release-1\"")
+	src.Put(key, string(publishValue(strconv.FormatInt(release, 10), `{}`)))
+
+	newSail := func(t *testing.T, hostname string) *etcdWatcher {
+		sail := New(&MetaConfig{
+			LogLevel:   "DEBUG",
+			ProjectKey: "test_project_key",
+			Namespace:  "test",
+			Configs:    "mysql.toml",
+		}, WithSource(src), WithInstance(Instance{Hostname: hostname, IP: "10.0.0.1"}))
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		require.NoError(t, sail.pullETCDConfig())
+		return NewWatcher(sail.ctx, sail).(*etcdWatcher)
+	}
+	running := newSail(t, "pod-2")
+
+	// 不开启 PublishOnly，出现过 PUBLISH 记录后草稿也不会被应用
+	draft := src.Put(key, "database=\"release-2\"")
+	draftKV, err := src.Get(context.Background(), key, draft)
+	require.NoError(t, err)
+	applied, err := running.dealETCDPut(draftKV)
+	require.NoError(t, err)
+	assert.Equal(t, false, applied)
+
+	publish := src.Put(key, string(publishValue(strconv.FormatInt(draft, 10), `{"instances":["pod-1"]}`)))
+	publishKV, err := src.Get(context.Background(), key, publish)
+	require.NoError(t, err)
+	applied, err = running.dealETCDPut(publishKV)
+	require.NoError(t, err)
+	assert.Equal(t, false, applied)
+
+	// 运行中的实例与重启后的实例使用同一个版本
+	restarted := newSail(t, "pod-2")
+	assert.Equal(t, "release-1", running.s.MustGetString("database"))
+	assert.Equal(t, "release-1", restarted.s.MustGetString("database"))
+}
@@ -0,0 +1,93 @@
+package sail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var ErrRetryExhausted = errors.New("ErrRetryExhausted")
+
+// RetryPolicy 重连配置中心的策略
+// 第 n 次重试前等待 InitialBackoff * Multiplier^(n-1)，不超过 MaxBackoff，
+// 再随机增减 Jitter 比例的时间，避免大量实例在配置中心恢复时同时重连
+type RetryPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64 // 0 ~ 1
+	MaxAttempts    int     // 最多重试的次数，0 为无限重试
+}
+
+// DefaultRetryPolicy 默认的重连策略，无限重试
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetryPolicy 重连配置中心的策略，默认 DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return optionFunc(func(v *Sail) {
+		v.retryPolicy = policy
+	})
+}
+
+func (p RetryPolicy) valid() error {
+	if p.InitialBackoff <= 0 || p.MaxBackoff < p.InitialBackoff {
+		return errors.New("retry policy backoff should be positive and max backoff not less than initial backoff. ")
+	}
+	if p.Multiplier < 1 {
+		return errors.New("retry policy multiplier should not be less than 1. ")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("retry policy jitter should be between 0 and 1. ")
+	}
+	if p.MaxAttempts < 0 {
+		return errors.New("retry policy max attempts should not be negative. ")
+	}
+	return nil
+}
+
+// backoff 第 attempt 次（从 1 开始）重试前的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt && wait < float64(p.MaxBackoff); i++ {
+		wait *= p.Multiplier
+	}
+	if wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(wait)
+}
+
+// retry 按策略重试 fn 直到成功，ctx 结束时返回 ctx.Err()，超过 MaxAttempts 时返回 ErrRetryExhausted
+// 每次失败都会记录日志，不会因为某种错误静默退出
+func (s *Sail) retry(ctx context.Context, name string, fn func() error) error {
+	policy := s.retryPolicy
+	wait := policy.backoff(1)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		s.setLastError(err)
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return fmt.Errorf("%w: %s fail after %d attempts: %v ", ErrRetryExhausted, name, attempt, err)
+		}
+		wait = policy.backoff(attempt + 1)
+		s.l.Warn(name+" fail, retry later. ", "attempt", attempt, "retry_in", wait, "err", err)
+	}
+}
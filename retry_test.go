@@ -0,0 +1,92 @@
+package sail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 8*time.Second, p.backoff(4))
+	assert.Equal(t, 10*time.Second, p.backoff(5))
+	assert.Equal(t, 10*time.Second, p.backoff(1000))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		wait := p.backoff(5)
+		assert.GreaterOrEqual(t, wait, 5*time.Second)
+		assert.LessOrEqual(t, wait, 15*time.Second)
+	}
+
+	assert.NoError(t, DefaultRetryPolicy.valid())
+	assert.Error(t, RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Millisecond, Multiplier: 2}.valid())
+	assert.Error(t, RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Second, Multiplier: 2, Jitter: 2}.valid())
+
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+	}, WithRetryPolicy(RetryPolicy{}))
+	assert.Error(t, sail.Err())
+}
+
+func TestSail_retry(t *testing.T) {
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+	}, WithRetryPolicy(RetryPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxAttempts:    3,
+	}))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	errAuth := errors.New("auth failed")
+
+	t.Run("Success", func(t *testing.T) {
+		attempts := 0
+		err := sail.retry(context.Background(), "test", func() error {
+			attempts++
+			if attempts < 3 {
+				// 非超时的错误也会重试
+				return errAuth
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		attempts := 0
+		err := sail.retry(context.Background(), "test", func() error {
+			attempts++
+			return errAuth
+		})
+		assert.ErrorIs(t, err, ErrRetryExhausted)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := sail.retry(ctx, "test", func() error {
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -8,15 +8,13 @@ import (
 	"net"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/HYY-yu/seckill.pkg/pkg/encrypt"
 	jww "github.com/spf13/jwalterweatherman"
 	"github.com/spf13/viper"
-	"go.etcd.io/etcd/client/pkg/v3/fileutil"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
 
@@ -27,19 +25,39 @@ const MergeConfigName = "config.toml"
 
 type OnConfigChange func(configFileKey string, s *Sail)
 
+// DeletePolicy 配置文件在 ETCD 中被删除时的处理策略
+type DeletePolicy int
+
+const (
+	// DeletePolicyRemove 从内存和备份文件中删除该配置（默认）
+	DeletePolicyRemove DeletePolicy = iota
+	// DeletePolicyKeep 保留最后一次的配置
+	DeletePolicyKeep
+)
+
 type MetaConfig struct {
 	ETCDEndpoints string `toml:"etcd_endpoints"` // 逗号分隔的ETCD地址，0.0.0.0:2379,0.0.0.0:12379,0.0.0.0:22379
 	ETCDUsername  string `toml:"etcd_username"`
 	ETCDPassword  string `toml:"etcd_password"`
 
-	ProjectKey   string `toml:"project_key"`
-	Namespace    string `toml:"namespace"`
-	NamespaceKey string `toml:"namespace_key"`
+	ProjectKey    string `toml:"project_key"`
+	Namespace     string `toml:"namespace"`
+	NamespaceKey  string `toml:"namespace_key"`
+	NamespaceKeys string `toml:"namespace_keys"` // 逗号分隔的密钥环 key_id:key，用于轮换命名空间密钥，如：k2:new-key,k1:old-key
+	KeyProvider   string `toml:"key_provider"`   // 密钥来源，env:NAME、file:/path/to/key 或 cmd:/path/to/helper args
 
 	Configs        string `toml:"configs"`          // 逗号分隔的 config_name.config_type，如：mysql.toml,cfg.json,redis.yaml，空代表不下载任何配置
 	ConfigFilePath string `toml:"config_file_path"` // 本地配置文件存放路径，空代表不存储本都配置文件
 	LogLevel       string `toml:"log_level"`        // 日志级别(DEBUG\INFO\WARN\ERROR)，默认 WARN
 	MergeConfig    bool   `toml:"merge_config"`     // 是否合并配置，合并配置则会将同类型的配置合并到一个文件中，需要先设置ConfigFilePath
+	WatchNamespace bool   `toml:"watch_namespace"`  // 是否接收整个命名空间的配置变更，默认只接收 Configs 内的配置
+	InstanceLabels string `toml:"instance_labels"`  // 逗号分隔的实例标签，用于灰度发布，如：zone=a,env=gray
+	BackupMode     string `toml:"backup_mode"`      // 备份文件的写入方式，plain（默认）、encrypt（加密后写入）、memory（加密过的配置不写入）
+	BackupKey      string `toml:"backup_key"`       // 加密备份文件的本地密钥，为空时使用命名空间密钥
+	OutputMode     string `toml:"output_mode"`      // 备份目录的写入方式，files（默认）、atomic_dir（快照目录加 ..data 软链接，用于 sidecar）
+	HistoryLimit   int    `toml:"history_limit"`    // 每个配置在 .history 中保留最近的版本数，0 为不保留
+	LocalFirst     bool   `toml:"local_first"`      // 启动时先加载本地备份文件，再在后台连接 etcd
+	PublishOnly    bool   `toml:"publish_only"`     // 配置的第一个版本也只使用 PUBLISH 记录指向的版本
 }
 
 func (m *MetaConfig) SplitETCDEndpoints() []string {
@@ -56,16 +74,20 @@ func (m *MetaConfig) SplitConfigs() []string {
 	return configs
 }
 
-func (m *MetaConfig) valid() error {
-	if len(m.ETCDEndpoints) == 0 {
+// valid requireETCD 为 false 时（使用了自定义的配置来源），不检查 ETCD 的配置
+// optionKeys 为 true 时，选项中设置了命名空间密钥或 KeyProvider
+func (m *MetaConfig) valid(requireETCD bool, optionKeys bool) error {
+	if requireETCD && len(m.ETCDEndpoints) == 0 {
 		return errors.New("please set etcd-endpoints. ")
 	}
 
-	endpoints := strings.Split(m.ETCDEndpoints, ",")
-	for _, e := range endpoints {
-		_, _, err := net.SplitHostPort(e)
-		if err != nil {
-			return fmt.Errorf("parse endpoints fail: %w ", err)
+	if len(m.ETCDEndpoints) > 0 {
+		endpoints := strings.Split(m.ETCDEndpoints, ",")
+		for _, e := range endpoints {
+			_, _, err := net.SplitHostPort(e)
+			if err != nil {
+				return fmt.Errorf("parse endpoints fail: %w ", err)
+			}
 		}
 	}
 
@@ -77,6 +99,33 @@ func (m *MetaConfig) valid() error {
 		return errors.New("please set namespace. ")
 	}
 
+	if _, err := parseNamespaceKeys(m.NamespaceKeys); err != nil {
+		return fmt.Errorf("parse namespace keys fail: %w ", err)
+	}
+
+	if len(m.KeyProvider) > 0 {
+		if _, err := parseKeyProvider(m.KeyProvider); err != nil {
+			return fmt.Errorf("parse key provider fail: %w ", err)
+		}
+	}
+
+	backupMode, err := parseBackupMode(m.BackupMode)
+	if err != nil {
+		return err
+	}
+	if backupMode == BackupEncrypt && !optionKeys && !m.hasKeySource() {
+		// 否则每次写入备份文件都会失败
+		return errors.New("backup mode encrypt needs backup-key, namespace-key, namespace-keys or key-provider. ")
+	}
+
+	if _, err := parseOutputMode(m.OutputMode); err != nil {
+		return err
+	}
+
+	if m.HistoryLimit < 0 {
+		return errors.New("history limit should not be negative. ")
+	}
+
 	if !checkLogLevel(m.LogLevel) {
 		return errors.New("please set correct log-level. ")
 	}
@@ -84,6 +133,10 @@ func (m *MetaConfig) valid() error {
 	return nil
 }
 
+func (m *MetaConfig) hasKeySource() bool {
+	return len(m.BackupKey) > 0 || len(m.NamespaceKey) > 0 || len(m.NamespaceKeys) > 0 || len(m.KeyProvider) > 0
+}
+
 func checkLogLevel(logLevel string) bool {
 	if len(strings.TrimSpace(logLevel)) == 0 {
 		return true
@@ -99,6 +152,9 @@ func checkLogLevel(logLevel string) bool {
 }
 
 type Sail struct {
+	// 最后一次应用的 etcd revision，原子操作，放在首位保证 64 位对齐
+	revision int64
+
 	metaConfig *MetaConfig
 	l          logger.Logger
 
@@ -106,29 +162,72 @@ type Sail struct {
 	etcdConfig    *clientv3.Config
 	etcdClient    *clientv3.Client
 
+	source Source
+
 	configs []string
 
 	vipers map[string]*viper.Viper
-	lock   *sync.RWMutex
+	raws   map[string][]byte // configFileKey -> 解密后的原始内容，与 vipers 一起由 lock 保护
+	// configFileKey -> 配置的 revision，从本地读取时为清单中记录的 revision
+	revisions map[string]int64
+	// configFileKey -> 回滚时配置中心的 revision，配置中心发布更新的版本后解除
+	pins map[string]int64
+	// configFileKey -> 配置的来源
+	origins map[string]ConfigOrigin
+	// configFileKey -> 出现过 PUBLISH 记录，之后直接写入的版本都是草稿
+	published map[string]bool
+	lock      *sync.RWMutex
+
+	bindings map[string][]*Binding
+	bindLock sync.Mutex
+
+	subscriptions []*subscription
+	subID         int
+	subLock       sync.Mutex
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	changeFunc OnConfigChange
+	instance Instance
+
+	decryptPolicy   DecryptPolicy
+	decryptErrs     map[string]*DecryptError
+	errorFunc       OnError
+	legacyPlaintext bool
+
+	keys        []NamespaceKey
+	keyProvider KeyProvider
+	keyUsage    map[string]map[string]struct{} // configFileKey -> 解密所用的密钥 ID
+	keyFailAt   time.Time                      // KeyProvider 上一次获取失败的时间
+	keyLock     sync.Mutex                     // 保护 keyUsage、decryptErrs 和 keyFailAt
 
-	fm      *FileMaintainer
-	watcher Watcher
+	metrics        MetricsRecorder
+	retryPolicy    RetryPolicy
+	fallbackPolicy FallbackPolicy
+
+	// synced 第一次从配置来源拉取成功后关闭
+	synced   chan struct{}
+	syncOnce sync.Once
+
+	reconnecting int32 // 原子操作，后台重连时为 1
+	statusLock   sync.Mutex
+	lastPullAt   time.Time
+	lastErr      error
+	lastErrAt    time.Time
+
+	changeFunc   OnConfigChange
+	removeFunc   OnConfigChange
+	deletePolicy DeletePolicy
+
+	backupMode BackupMode
+	outputMode OutputMode
+	fm         *FileMaintainer
+	watcher    Watcher
 
 	err error
 }
 
 func New(meta *MetaConfig, opts ...Option) *Sail {
-	if err := meta.valid(); err != nil {
-		return &Sail{
-			err: err,
-		}
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &Sail{
 		metaConfig: meta,
@@ -137,11 +236,43 @@ func New(meta *MetaConfig, opts ...Option) *Sail {
 		etcdEndpoints: meta.SplitETCDEndpoints(),
 		configs:       meta.SplitConfigs(),
 
-		vipers: make(map[string]*viper.Viper),
-		lock:   &sync.RWMutex{},
-		ctx:    ctx,
-		cancel: cancel,
+		instance: newInstance(meta),
+
+		vipers:      make(map[string]*viper.Viper),
+		raws:        make(map[string][]byte),
+		revisions:   make(map[string]int64),
+		pins:        make(map[string]int64),
+		origins:     make(map[string]ConfigOrigin),
+		published:   make(map[string]bool),
+		lock:        &sync.RWMutex{},
+		bindings:    make(map[string][]*Binding),
+		keyUsage:    make(map[string]map[string]struct{}),
+		decryptErrs: make(map[string]*DecryptError),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		metrics:        noopMetrics{},
+		retryPolicy:    DefaultRetryPolicy,
+		fallbackPolicy: DefaultFallbackPolicy,
+		synced:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	if err := meta.valid(s.source == nil, len(s.keys) > 0 || s.keyProvider != nil); err != nil {
+		cancel()
+		return &Sail{
+			err: err,
+		}
+	}
+	if err := s.retryPolicy.valid(); err != nil {
+		cancel()
+		return &Sail{
+			err: err,
+		}
 	}
+
 	thre := map[string]jww.Threshold{
 		"DEBUG": 1,
 		"INFO":  2,
@@ -151,10 +282,16 @@ func New(meta *MetaConfig, opts ...Option) *Sail {
 
 	jww.SetStdoutThreshold(thre)
 
-	for _, opt := range opts {
-		opt.apply(s)
+	s.keys = buildKeyring(meta, s.keys)
+	s.backupMode, _ = parseBackupMode(meta.BackupMode)
+	s.outputMode, _ = parseOutputMode(meta.OutputMode)
+	if s.keyProvider == nil && len(meta.KeyProvider) > 0 {
+		s.keyProvider, _ = parseKeyProvider(meta.KeyProvider)
 	}
 
+	if s.source == nil {
+		s.source = newETCDSource(s)
+	}
 	s.fm = NewFileMaintainer(s)
 	s.watcher = NewWatcher(s.ctx, s)
 
@@ -194,6 +331,22 @@ func WithOnConfigChange(f OnConfigChange) Option {
 	})
 }
 
+// WithOnConfigRemove 配置文件被删除的回调
+// configFileKey 被删除的配置文件名
+// 无论 DeletePolicy 为何值都会回调
+func WithOnConfigRemove(f OnConfigChange) Option {
+	return optionFunc(func(v *Sail) {
+		v.removeFunc = f
+	})
+}
+
+// WithDeletePolicy 配置文件在 ETCD 中被删除时的处理策略，默认 DeletePolicyRemove
+func WithDeletePolicy(policy DeletePolicy) Option {
+	return optionFunc(func(v *Sail) {
+		v.deletePolicy = policy
+	})
+}
+
 // WithLogger
 // 强烈建议替换为自己的Logger，自带的 logger 比较简单
 func WithLogger(logger logger.Logger) Option {
@@ -210,6 +363,30 @@ func WithMergeConfig(merge bool) Option {
 	})
 }
 
+// WithWatchNamespace 接收整个命名空间下所有配置文件的变更
+// 默认只接收 Configs 内的配置文件的变更
+func WithWatchNamespace(watchNamespace bool) Option {
+	return optionFunc(func(v *Sail) {
+		v.metaConfig.WatchNamespace = watchNamespace
+	})
+}
+
+// WithInstance 指定实例标识，用于灰度发布
+// 为空的字段会使用自动获取的值：Hostname 取主机名，IP 取第一个非回环的 IPv4 地址，Labels 取 InstanceLabels
+func WithInstance(ins Instance) Option {
+	return optionFunc(func(v *Sail) {
+		if len(ins.Hostname) > 0 {
+			v.instance.Hostname = ins.Hostname
+		}
+		if len(ins.IP) > 0 {
+			v.instance.IP = ins.IP
+		}
+		if ins.Labels != nil {
+			v.instance.Labels = ins.Labels
+		}
+	})
+}
+
 // WithETCDClientConfig 自定义的 ETCD 连接配置
 func WithETCDClientConfig(cfg *clientv3.Config) Option {
 	return optionFunc(func(v *Sail) {
@@ -217,98 +394,152 @@ func WithETCDClientConfig(cfg *clientv3.Config) Option {
 	})
 }
 
+// Instance 本实例的标识
+func (s *Sail) Instance() Instance {
+	return s.instance
+}
+
 // Err 初始化（New）时，失败的 Error 会保存在此处
 // 例：
 // s := sail.New()
 // err := s.Err()
-// if err != nil{
-//    doing...
-// }
+//
+//	if err != nil{
+//	   doing...
+//	}
 func (s *Sail) Err() error {
 	return s.err
 }
 
 // Pull 配置拉取
-// 当无法访问 ETCD 时，会自动导入备份配置文件中的配置，同时自动重连 etcd。
+// 当无法访问 ETCD 时，按 FallbackPolicy 导入备份配置文件中的配置，同时自动重连 etcd。
+// 使用 WithSource 替换了配置来源时，直接从配置来源拉取。
 func (s *Sail) Pull() error {
 	if s.Err() != nil {
 		return s.Err()
 	}
+	if s.metaConfig.LocalFirst && s.pullLocalFirst() {
+		return nil
+	}
+	if _, ok := s.source.(*etcdSource); !ok {
+		if err := s.pullETCDConfig(); err != nil {
+			return s.fallbackLocal(FallbackOnReadError, err)
+		}
+		return nil
+	}
 
+	start := time.Now()
 	etcdClient, err := s.etcdConnect()
 	if err != nil {
-		if err == context.DeadlineExceeded && !fileutil.DirEmpty(s.metaConfig.ConfigFilePath) {
-			s.l.Warn("using local file because can't connect etcd, the connection will retry after 30s. ")
-			err := s.readLocalFileConfig()
-			if err != nil {
-				return err
-			}
-
-			// 重连 ETCD
-			go s.reconnectEtcd()
-			return nil
-		}
-		return fmt.Errorf("can't connect etcd with unknow err: %w ", err)
+		s.metrics.ObservePull(time.Since(start), err)
+		return s.fallbackLocal(FallbackOnConnectError, fmt.Errorf("can't connect etcd with unknow err: %w ", err))
 	}
 	s.l.Debug("connect etcd success. ")
 	s.etcdClient = etcdClient
 
 	err = s.pullETCDConfig()
 	if err != nil {
-		return err
+		return s.fallbackLocal(FallbackOnReadError, err)
 	}
 
 	return nil
 }
 
 func (s *Sail) pullETCDConfig() error {
+	err := s.loadETCDConfig()
+	if err != nil {
+		return err
+	}
+
+	s.watcher.Run()
+	return nil
+}
+
+// loadETCDConfig 全量拉取配置，不启动监听
+func (s *Sail) loadETCDConfig() (err error) {
+	start := time.Now()
+	defer func() {
+		s.metrics.ObservePull(time.Since(start), err)
+	}()
+
 	if len(s.configs) == 0 {
 		// 不获取任何配置，直接退出
+		s.markSynced()
 		return nil
 	}
 
-	// s.configs 是有序的，etcd里的key是有序的
-	// 那么，只需要获取 from-key = s.configs[0]   limit=s.configs 即可获取到所有需要的key。
+	// 配置来源返回的 key 是有序的，s.configs 也是有序的，取交集即可
 	keyPrefix := s.getETCDKeyPrefix()
-	formKey := s.configs[0]
-	limit := len(s.configs)
 	s.l.Debug("pull config key", "keys", s.configs)
 
-	getResp, err := s.etcdClient.Get(s.ctx,
-		keyPrefix+formKey,
-		clientv3.WithFromKey(),
-		clientv3.WithLimit(int64(limit)),
-	)
+	kvs, revision, err := s.source.List(s.ctx, keyPrefix)
 	if err != nil {
 		return fmt.Errorf("read config from etcd err: %w ", err)
 	}
-	etcdKeys := make([]string, 0, len(s.configs))
-	for _, e := range getResp.Kvs {
-		etcdKeys = append(etcdKeys, getConfigFileKeyFrom(string(e.Key)))
+	etcdKeys := make([]string, 0, len(kvs))
+	for _, e := range kvs {
+		etcdKeys = append(etcdKeys, getConfigFileKeyFrom(e.Key))
 	}
-	if len(etcdKeys) == 0 {
+	if len(etcdKeys) == 0 && !s.Synced() {
+		// 第一次拉取时为空，通常是配置错误，保留本地备份文件中的配置
+		// 拉取成功过之后为空，代表配置都被删除了
 		return fmt.Errorf("read empty config from etcd! ")
 	}
+	s.storeRevision(revision)
 
 	insETCDKeys := intersectionSortStringArr(etcdKeys, s.configs)
 	s.l.Debug("real config key", "keys", insETCDKeys)
 
+	type replaced struct {
+		key           string
+		configFileKey string
+		oldViper      *viper.Viper
+		newViper      *viper.Viper
+		revision      int64
+	}
+	var replacedVipers []replaced
+	var updated []string
+	var decryptErrs []*DecryptError
+	defer func() {
+		for _, e := range decryptErrs {
+			s.reportError(e)
+		}
+	}()
+
+	// 在持有 s.lock 之前获取密钥
+	keys := s.keyring()
+
 	s.lock.Lock()
-	for _, e := range getResp.Kvs {
-		configFileKey := getConfigFileKeyFrom(string(e.Key))
+	for _, e := range kvs {
+		configFileKey := getConfigFileKeyFrom(e.Key)
 		for _, ins := range insETCDKeys {
 			if ins == configFileKey {
-				isPublish, reversion := s.checkPublish(e.Value)
-				if isPublish {
-					newValue, err := s.readFromReversion(e.Key, int64(reversion))
-					if err != nil {
-						s.lock.Unlock()
-						return err
-					}
-					e.Value = newValue
+				value, published, err := s.resolveTargetedRelease(e)
+				if published {
+					s.published[configFileKey] = true
+				} else {
+					delete(s.published, configFileKey)
+				}
+				if errors.Is(err, ErrNotTargeted) || errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrSourceCompacted) {
+					// 与 watch 一致，跳过该配置，不影响其他配置
+					s.l.Warn("can't find a release for this instance, skip it. ", "key", configFileKey, "err", err)
+					continue
+				}
+				if err != nil {
+					s.lock.Unlock()
+					return err
+				}
+				if s.keepPinned(configFileKey, e.ModRevision) {
+					s.l.Warn("config was rolled back, skip it until the next publish. ", "key", configFileKey)
+					continue
 				}
 
-				viperETCD, err := s.newViperWithETCDValue(configFileKey, e.Value)
+				viperETCD, raw, err := s.newViperWithETCDValue(configFileKey, value, keys)
+				var derr *DecryptError
+				if errors.As(err, &derr) {
+					decryptErrs = append(decryptErrs, derr)
+					viperETCD, raw, err = s.decryptFallback(derr, keys)
+				}
 				if err != nil {
 					s.lock.Unlock()
 					return err
@@ -317,63 +548,129 @@ func (s *Sail) pullETCDConfig() error {
 					continue
 				}
 
+				// 本地备份文件中的同一版本不算变更
+				old, ok := s.vipers[configFileKey]
+				changed := !ok || s.revisions[configFileKey] != e.ModRevision
+				if ok && changed {
+					replacedVipers = append(replacedVipers, replaced{e.Key, configFileKey, old, viperETCD, e.ModRevision})
+				}
+				if changed && derr == nil {
+					updated = append(updated, configFileKey)
+				}
 				s.vipers[configFileKey] = viperETCD
+				s.raws[configFileKey] = raw
+				if derr == nil {
+					s.revisions[configFileKey] = e.ModRevision
+					s.origins[configFileKey] = OriginRemote
+				} else {
+					s.revisions[configFileKey] = s.fm.manifestRevision(configFileKey)
+					s.origins[configFileKey] = OriginLocal
+				}
 			}
 		}
 	}
+	// 配置来源中已不存在的配置，按删除处理，如重连、revision 被压缩期间删除的配置
+	listed := make(map[string]bool, len(etcdKeys))
+	for _, e := range etcdKeys {
+		listed[e] = true
+	}
+	var deleted []string
+	for k := range s.vipers {
+		if k != MergeConfigName && !listed[k] && s.isConfigWatched(k) {
+			deleted = append(deleted, k)
+		}
+	}
+	if s.metaConfig.MergeConfig && s.origins[MergeConfigName] == OriginLocal {
+		// 先前从本地读取的合并配置，已被配置来源中的各个配置代替
+		delete(s.vipers, MergeConfigName)
+		delete(s.raws, MergeConfigName)
+		delete(s.revisions, MergeConfigName)
+		delete(s.origins, MergeConfigName)
+	}
 	s.lock.Unlock()
 
-	err = s.fm.saveConfigFile()
-	if err != nil {
-		return err
+	sort.Strings(deleted)
+	for _, e := range deleted {
+		s.deleteConfig(keyPrefix+e, revision)
 	}
+	for _, e := range updated {
+		s.metrics.SetConfigUpdated(e, start)
+	}
+	for _, e := range insETCDKeys {
+		s.refreshBindings(e)
+	}
+	// 重连或先加载本地备份文件后的拉取，需要通知订阅者
+	for _, e := range replacedVipers {
+		s.notifyKeyChange(e.configFileKey, e.oldViper, e.newViper, e.revision)
+		if s.changeFunc != nil {
+			s.changeFunc(e.key, s)
+		}
+	}
+	s.setLastPull()
 
-	s.watcher.Run()
+	// 写完备份文件后再通知 WaitSynced，之后读取备份目录的都是新版本
+	// 写入失败不算拉取失败，否则会改用更旧的本地备份文件，交给后台写入协程重试并记录到 BackupErrors
+	if saveErr := s.fm.saveConfigFile(); saveErr != nil {
+		s.l.Error("save config file fail, retry in background. ", "err", saveErr)
+		for _, e := range insETCDKeys {
+			s.fm.asyncWriteConfigFile(e)
+		}
+	}
+	s.markSynced()
 	return nil
 }
 
-func (s *Sail) checkPublish(etcdValue []byte) (isPublish bool, reversion int) {
-	etcdValueStr := string(etcdValue)
-
-	if strings.HasPrefix(etcdValueStr, "PUBLISH") {
-		publishStrArr := strings.Split(etcdValueStr, "&")
+func (s *Sail) loadRevision() int64 {
+	return atomic.LoadInt64(&s.revision)
+}
 
-		if len(publishStrArr) != 5 {
-			return false, 0
+// storeRevision 只会往前推进 revision
+func (s *Sail) storeRevision(revision int64) {
+	for {
+		old := atomic.LoadInt64(&s.revision)
+		if revision <= old {
+			return
 		}
+		if atomic.CompareAndSwapInt64(&s.revision, old, revision) {
+			return
+		}
+	}
+}
+
+// WatchHealth 配置监听的健康状况
+func (s *Sail) WatchHealth() WatchHealth {
+	if s.watcher == nil {
+		return WatchHealth{}
+	}
+	return s.watcher.Health()
+}
 
-		reversion, _ := strconv.Atoi(publishStrArr[3])
-		return true, reversion
+func (s *Sail) checkPublish(etcdValue []byte) (isPublish bool, reversion int) {
+	record, isPublish := parsePublish(etcdValue)
+	if !isPublish {
+		return false, 0
 	}
-	return false, 0
+	return true, record.Reversion
 }
 
-func (s *Sail) readFromReversion(etcdKey []byte, reversion int64) ([]byte, error) {
-	getResp, err := s.etcdClient.Get(s.ctx,
-		string(etcdKey),
-		clientv3.WithRev(reversion),
-	)
+func (s *Sail) readFromReversion(etcdKey string, reversion int64) ([]byte, error) {
+	kv, err := s.source.Get(s.ctx, etcdKey, reversion)
 	if err != nil {
 		return nil, err
 	}
-	if len(getResp.Kvs) == 0 {
-		return nil, fmt.Errorf("cannot find etcdKey: %s", string(etcdKey))
-	}
-
-	return getResp.Kvs[0].Value, nil
+	return kv.Value, nil
 }
 
-func (s *Sail) newViperWithETCDValue(configFileKey string, etcdValue []byte) (*viper.Viper, error) {
+// newViperWithETCDValue 同时返回解密后的原始内容，解密失败时返回 *DecryptError
+func (s *Sail) newViperWithETCDValue(configFileKey string, etcdValue []byte, keys []NamespaceKey) (*viper.Viper, []byte, error) {
 	viperETCD := viper.New()
 	configType := strings.TrimPrefix(filepath.Ext(configFileKey), ".")
-	valueReader := bytes.NewBuffer(etcdValue)
 
-	if c := s.tryDecryptConfigContent(configFileKey, valueReader.String()); len(c) > 0 {
-		valueReader = bytes.NewBufferString(c)
-	} else {
-		s.l.Error("decrypt config fail, skip it. ", "key", configFileKey)
-		return nil, nil
+	c, err := s.decryptConfig(configFileKey, string(etcdValue), keys)
+	if err != nil {
+		return nil, nil, err
 	}
+	valueReader := bytes.NewBufferString(c)
 
 	if configType == "custom" {
 		viperETCD.Set(configFileKey, valueReader.String())
@@ -381,36 +678,25 @@ func (s *Sail) newViperWithETCDValue(configFileKey string, etcdValue []byte) (*v
 		viperETCD.SetConfigType(configType)
 		err := viperETCD.ReadConfig(valueReader)
 		if err != nil {
-			return nil, fmt.Errorf("viper fail: read config from etcd err: %w ", err)
+			return nil, nil, fmt.Errorf("viper fail: read config from etcd err: %w ", err)
 		}
-	}
-	return viperETCD, nil
-}
-
-func (s *Sail) tryDecryptConfigContent(configKey, content string) string {
-	_, err := encrypt.NewBase64Encoding().DecodeString(content)
-	if err == nil {
-		decryptContent, err := decryptConfigContent(content, s.metaConfig.NamespaceKey)
-		if err != nil {
-			// 报错、跳过，不中断运行。
-			s.l.Error("decrypt config %s err:%w ", configKey, err)
-			return ""
+		if err := s.decryptConfigFields(configFileKey, viperETCD, keys); err != nil {
+			return nil, nil, err
 		}
-		content = decryptContent
 	}
-	return content
+	s.setDecryptError(configFileKey, nil)
+	return viperETCD, []byte(c), nil
 }
 
-func decryptConfigContent(content string, namespaceKey string) (string, error) {
-	if namespaceKey == "" {
-		return "", nil
-	}
-
-	goAES := encrypt.NewGoAES(namespaceKey, encrypt.AES192)
-	decryptContent, err := goAES.WithModel(encrypt.ECB).WithEncoding(encrypt.NewBase64Encoding()).Decrypt(content)
+// decryptConfig 用 keys 解密整个配置，失败时返回 *DecryptError
+func (s *Sail) decryptConfig(configKey, content string, keys []NamespaceKey) (string, error) {
+	decryptContent, keyID, err := decryptWithKeys(content, keys, s.legacyPlaintext)
 	if err != nil {
-		return "", err
+		derr := &DecryptError{ConfigFileKey: configKey, Err: err}
+		s.setDecryptError(configKey, derr)
+		return "", derr
 	}
+	s.markKeyUsage(configKey, keyID)
 	return decryptContent, nil
 }
 
@@ -430,37 +716,56 @@ func (s *Sail) getETCDKeyPrefix() string {
 	return b.String()
 }
 
+// isConfigWatched 监听到的配置文件是否需要处理
+func (s *Sail) isConfigWatched(configFileKey string) bool {
+	if s.metaConfig.WatchNamespace {
+		return true
+	}
+	for _, e := range s.configs {
+		if e == configFileKey {
+			return true
+		}
+	}
+	return false
+}
+
 func getConfigFileKeyFrom(etcdKey string) string {
 	_, result := filepath.Split(etcdKey)
 	return result
 }
 
+// reconnectEtcd 按 RetryPolicy 重连 etcd（或其他配置来源）并拉取配置，期间继续使用本地备份文件中的配置
 func (s *Sail) reconnectEtcd() {
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-time.After(30 * time.Second):
-			etcdClient, err := s.etcdConnect()
-			if err != nil {
-				if err == context.DeadlineExceeded {
-					continue
-				}
-				s.l.Error("reconnect exit because err: %w ", err)
-				return
-			}
-			s.etcdClient = etcdClient
-			s.l.Info("reconnect etcd success! ")
-			err = s.pullETCDConfig()
-			if err != nil {
-				s.l.Error("pull etcd config fail, retry in next 30s. ")
-				_ = s.etcdClient.Close()
-				s.etcdClient = nil
-				continue
-			}
-			return
+	atomic.StoreInt32(&s.reconnecting, 1)
+	defer atomic.StoreInt32(&s.reconnecting, 0)
+
+	err := s.retry(s.ctx, "reconnect etcd", func() error {
+		err := s.connectAndPull()
+		s.metrics.IncReconnect(err)
+		return err
+	})
+	if err == nil {
+		s.l.Info("reconnect etcd success! ")
+		return
+	}
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.l.Error("reconnect etcd give up. ", "err", err)
+	s.reportError(err)
+}
+
+// connectAndPull 连接 etcd（已连接时跳过）并拉取配置
+// 拉取失败时保留连接，下次直接重新拉取
+func (s *Sail) connectAndPull() error {
+	if _, ok := s.source.(*etcdSource); ok && s.etcdClient == nil {
+		etcdClient, err := s.etcdConnect()
+		if err != nil {
+			return err
 		}
+		s.etcdClient = etcdClient
 	}
+	return s.pullETCDConfig()
 }
 
 func (s *Sail) etcdConnect() (*clientv3.Client, error) {
@@ -491,6 +796,10 @@ func (s *Sail) Close() error {
 	if s.cancel != nil {
 		s.cancel()
 	}
+	if s.fm != nil {
+		// 写完排队中的备份文件
+		s.fm.closeWriter()
+	}
 	if s.etcdClient != nil {
 		err := s.etcdClient.Close()
 		if err != nil {
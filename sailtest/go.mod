@@ -0,0 +1,11 @@
+module github.com/HYY-yu/sail-client/sailtest
+
+go 1.16
+
+require (
+	github.com/HYY-yu/sail-client v0.0.0-20261017134720-3437257dcd70
+	github.com/HYY-yu/seckill.pkg v1.3.4
+	github.com/stretchr/testify v1.8.0
+	go.etcd.io/etcd/client/v3 v3.5.5
+	go.etcd.io/etcd/server/v3 v3.5.5
+)
@@ -0,0 +1,231 @@
+// Package sailtest 启动一个内嵌的 etcd，用于不依赖外部 etcd 集群的集成测试
+// sailtest 是单独的 module，使用 sail-client 不会引入 etcd server 的依赖
+// 例：
+// srv := sailtest.Start(t)
+// srv.PutConfig(t, "project", "dev", "mysql.toml", `database="127.0.0.1:3306"`)
+// s := srv.NewSail(t, srv.MetaConfig("project", "dev", "mysql.toml"))
+package sailtest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HYY-yu/seckill.pkg/pkg/encrypt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	sail "github.com/HYY-yu/sail-client"
+)
+
+const startTimeout = 30 * time.Second
+
+// Server 内嵌的 etcd 服务，测试结束时自动关闭并清理数据目录
+type Server struct {
+	cfg    *embed.Config
+	etcd   *embed.Etcd
+	Client *clientv3.Client
+}
+
+// Start 在临时目录中启动一个单节点 etcd
+func Start(t testing.TB) *Server {
+	t.Helper()
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	srv := &Server{cfg: cfg}
+	srv.start(t)
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{srv.Endpoint()},
+		DialTimeout: startTimeout,
+	})
+	if err != nil {
+		t.Fatalf("sailtest: connect embed etcd err: %v", err)
+	}
+	srv.Client = client
+
+	t.Cleanup(func() {
+		_ = srv.Client.Close()
+		srv.Stop()
+	})
+	return srv
+}
+
+func (s *Server) start(t testing.TB) {
+	t.Helper()
+
+	e, err := embed.StartEtcd(s.cfg)
+	if err != nil {
+		t.Fatalf("sailtest: start embed etcd err: %v", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(startTimeout):
+		e.Close()
+		t.Fatalf("sailtest: embed etcd not ready after %s", startTimeout)
+	}
+	s.etcd = e
+}
+
+// Stop 停止 etcd，数据目录保留，可以用 Restart 重新启动，用于测试断线重连
+func (s *Server) Stop() {
+	if s.etcd != nil {
+		s.etcd.Close()
+		s.etcd = nil
+	}
+}
+
+// Restart 以相同的地址和数据目录重新启动 etcd
+func (s *Server) Restart(t testing.TB) {
+	t.Helper()
+
+	s.Stop()
+	s.start(t)
+}
+
+// Endpoint host:port 形式的 etcd 地址，可直接用于 MetaConfig.ETCDEndpoints
+func (s *Server) Endpoint() string {
+	return s.cfg.ACUrls[0].Host
+}
+
+// MetaConfig 连接本 etcd 的配置，备份文件存放在临时目录中
+func (s *Server) MetaConfig(projectKey, namespace string, configs ...string) *sail.MetaConfig {
+	return &sail.MetaConfig{
+		ETCDEndpoints: s.Endpoint(),
+		ProjectKey:    projectKey,
+		Namespace:     namespace,
+		Configs:       strings.Join(configs, ","),
+		LogLevel:      "ERROR",
+	}
+}
+
+// NewSail 创建并 Pull 一个 Sail，测试结束时自动关闭
+func (s *Server) NewSail(t testing.TB, meta *sail.MetaConfig, opts ...sail.Option) *sail.Sail {
+	t.Helper()
+
+	if len(meta.ConfigFilePath) == 0 {
+		meta.ConfigFilePath = t.TempDir()
+	}
+	sa := sail.New(meta, opts...)
+	if err := sa.Err(); err != nil {
+		t.Fatalf("sailtest: new sail err: %v", err)
+	}
+	if err := sa.Pull(); err != nil {
+		t.Fatalf("sailtest: pull err: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = sa.Close()
+	})
+	return sa
+}
+
+// ConfigKey /conf/{project_key}/{namespace}/{config_file_key}
+func ConfigKey(projectKey, namespace, configFileKey string) string {
+	return path.Join("/conf", projectKey, namespace, configFileKey)
+}
+
+// Put 写入任意 key，返回写入后的 revision
+func (s *Server) Put(t testing.TB, key, value string) int64 {
+	t.Helper()
+
+	resp, err := s.Client.Put(context.Background(), key, value)
+	if err != nil {
+		t.Fatalf("sailtest: put %s err: %v", key, err)
+	}
+	return resp.Header.Revision
+}
+
+// Delete 删除任意 key，返回删除后的 revision
+func (s *Server) Delete(t testing.TB, key string) int64 {
+	t.Helper()
+
+	resp, err := s.Client.Delete(context.Background(), key)
+	if err != nil {
+		t.Fatalf("sailtest: delete %s err: %v", key, err)
+	}
+	return resp.Header.Revision
+}
+
+// Compact 压缩 revision 之前的历史版本
+func (s *Server) Compact(t testing.TB, revision int64) {
+	t.Helper()
+
+	_, err := s.Client.Compact(context.Background(), revision, clientv3.WithCompactPhysical())
+	if err != nil {
+		t.Fatalf("sailtest: compact %d err: %v", revision, err)
+	}
+}
+
+// PutConfig 写入明文配置
+func (s *Server) PutConfig(t testing.TB, projectKey, namespace, configFileKey, content string) int64 {
+	t.Helper()
+	return s.Put(t, ConfigKey(projectKey, namespace, configFileKey), content)
+}
+
+// PutEncryptedConfig 以命名空间密钥加密（SAILENC v2）后写入配置
+func (s *Server) PutEncryptedConfig(t testing.TB, projectKey, namespace, configFileKey, content, namespaceKey string) int64 {
+	t.Helper()
+
+	encrypted, err := sail.EncryptConfigContent(content, namespaceKey)
+	if err != nil {
+		t.Fatalf("sailtest: encrypt %s err: %v", configFileKey, err)
+	}
+	return s.PutConfig(t, projectKey, namespace, configFileKey, encrypted)
+}
+
+// PutLegacyEncryptedConfig 以旧格式（base64 AES-192-ECB）加密后写入配置
+func (s *Server) PutLegacyEncryptedConfig(t testing.TB, projectKey, namespace, configFileKey, content, namespaceKey string) int64 {
+	t.Helper()
+
+	encrypted, err := encrypt.NewGoAES(namespaceKey, encrypt.AES192).
+		WithModel(encrypt.ECB).
+		WithEncoding(encrypt.NewBase64Encoding()).
+		Encrypt(content)
+	if err != nil {
+		t.Fatalf("sailtest: encrypt %s err: %v", configFileKey, err)
+	}
+	return s.PutConfig(t, projectKey, namespace, configFileKey, encrypted)
+}
+
+// Publish 写入指向 reversion 的 PUBLISH 记录，target 为 nil 代表全量发布
+func (s *Server) Publish(t testing.TB, projectKey, namespace, configFileKey string, reversion int64, target *sail.PublishTarget) int64 {
+	t.Helper()
+
+	data := ""
+	if target != nil {
+		targetJSON, err := json.Marshal(target)
+		if err != nil {
+			t.Fatalf("sailtest: marshal publish target err: %v", err)
+		}
+		data = base64.StdEncoding.EncodeToString(targetJSON)
+	}
+	record := fmt.Sprintf("PUBLISH&sailtest&1&%s&%s", strconv.FormatInt(reversion, 10), data)
+	return s.PutConfig(t, projectKey, namespace, configFileKey, record)
+}
+
+func freeURL(t testing.TB) url.URL {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("sailtest: find free port err: %v", err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
@@ -0,0 +1,100 @@
+package sailtest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sail "github.com/HYY-yu/sail-client"
+)
+
+const (
+	testProject      = "test_project_key"
+	testNamespace    = "test"
+	testNamespaceKey = "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD"
+)
+
+func TestServer_PullAndWatch(t *testing.T) {
+	srv := Start(t)
+	srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"127.0.0.1:3306\"")
+	srv.PutEncryptedConfig(t, testProject, testNamespace, "redis.properties", "host=0.0.0.0\nport=6379", testNamespaceKey)
+	srv.PutLegacyEncryptedConfig(t, testProject, testNamespace, "log.yaml", "level: debug", testNamespaceKey)
+
+	meta := srv.MetaConfig(testProject, testNamespace, "log.yaml", "mysql.toml", "redis.properties")
+	meta.NamespaceKey = testNamespaceKey
+	s := srv.NewSail(t, meta)
+
+	assert.Equal(t, "127.0.0.1:3306", s.MustGetString("database"))
+	assert.Equal(t, "6379", s.MustGetString("port"))
+	assert.Equal(t, "debug", s.MustGetString("level"))
+
+	srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"0.0.0.0:3306\"")
+	assert.Eventually(t, func() bool {
+		return s.MustGetString("database") == "0.0.0.0:3306"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	srv.Delete(t, ConfigKey(testProject, testNamespace, "mysql.toml"))
+	assert.Eventually(t, func() bool {
+		return s.GetViperWithName("mysql.toml") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Publish(t *testing.T) {
+	srv := Start(t)
+	first := srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"release-1\"")
+	srv.Publish(t, testProject, testNamespace, "mysql.toml", first, nil)
+
+	s := srv.NewSail(t, srv.MetaConfig(testProject, testNamespace, "mysql.toml"),
+		sail.WithInstance(sail.Instance{Hostname: "pod-1"}))
+	assert.Equal(t, "release-1", s.MustGetString("database"))
+
+	var lock sync.Mutex
+	var seen []interface{}
+	s.Subscribe("mysql.toml", "database", func(ev sail.KeyChange) {
+		lock.Lock()
+		defer lock.Unlock()
+		seen = append(seen, ev.NewValue)
+	})
+
+	// 草稿在发布前不会被应用
+	rev := srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"release-2\"")
+	srv.Publish(t, testProject, testNamespace, "mysql.toml", rev, nil)
+	assert.Eventually(t, func() bool {
+		return s.MustGetString("database") == "release-2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// 灰度到其他实例，本实例不变
+	grayRev := srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"release-3\"")
+	srv.Publish(t, testProject, testNamespace, "mysql.toml", grayRev, &sail.PublishTarget{Instances: []string{"pod-2"}})
+	// 全量发布 rev
+	last := srv.Publish(t, testProject, testNamespace, "mysql.toml", rev, nil)
+	assert.Eventually(t, func() bool {
+		return s.WatchHealth().Revision >= last
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "release-2", s.MustGetString("database"))
+	lock.Lock()
+	assert.Equal(t, []interface{}{"release-2"}, seen)
+	lock.Unlock()
+
+	srv.Publish(t, testProject, testNamespace, "mysql.toml", grayRev, &sail.PublishTarget{Instances: []string{"pod-1"}})
+	assert.Eventually(t, func() bool {
+		return s.MustGetString("database") == "release-3"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Restart(t *testing.T) {
+	srv := Start(t)
+	srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"127.0.0.1:3306\"")
+	s := srv.NewSail(t, srv.MetaConfig(testProject, testNamespace, "mysql.toml"))
+
+	srv.Restart(t)
+	srv.PutConfig(t, testProject, testNamespace, "mysql.toml", "database=\"0.0.0.0:3306\"")
+	assert.Eventually(t, func() bool {
+		return s.MustGetString("database") == "0.0.0.0:3306"
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, true, s.WatchHealth().Running)
+}
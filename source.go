@@ -0,0 +1,56 @@
+package sail
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrSourceCompacted = errors.New("ErrSourceCompacted")
+	ErrKeyNotFound     = errors.New("ErrKeyNotFound")
+)
+
+// Source 配置来源，默认为 ETCD
+// key 的格式为 /conf/{project_key}/{namespace}/{config_name.config_type}
+type Source interface {
+	// List 获取所有以 prefix 为前缀的配置（按 key 排序），以及当前的 revision
+	List(ctx context.Context, prefix string) ([]*KeyValue, int64, error)
+
+	// Get 获取 key 在 revision 时的值，revision 为 0 代表最新的值
+	// key 不存在时返回 ErrKeyNotFound，revision 已被压缩时返回 ErrSourceCompacted
+	Get(ctx context.Context, key string, revision int64) (*KeyValue, error)
+
+	// Watch 监听 prefix 下的配置变更，fromRevision 为 0 代表从当前开始监听
+	// ctx 结束或监听出错后关闭 channel，fromRevision 已被压缩时返回 ErrSourceCompacted
+	Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse
+}
+
+type KeyValue struct {
+	Key         string
+	Value       []byte
+	ModRevision int64
+}
+
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+type Event struct {
+	Type EventType
+	KV   *KeyValue
+}
+
+type WatchResponse struct {
+	Events []*Event
+	Err    error
+}
+
+// WithSource 替换配置来源，替换后无需配置 ETCD 相关的参数
+func WithSource(source Source) Option {
+	return optionFunc(func(v *Sail) {
+		v.source = source
+	})
+}
@@ -0,0 +1,143 @@
+package sail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DirSource 本地目录作为配置来源，用于本地开发
+// key 对应 dir 下的同名路径，如：/conf/project/dev/mysql.toml 对应 {dir}/conf/project/dev/mysql.toml
+// 通过定时扫描目录发现变更，每次变更都会分配一个新的 revision（仅在本进程内有效）
+type DirSource struct {
+	dir      string
+	interval time.Duration
+
+	mu  sync.Mutex
+	mem *MemorySource
+}
+
+// NewDirSource interval 为扫描目录的间隔，<=0 时默认为 1s
+func NewDirSource(dir string, interval time.Duration) *DirSource {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &DirSource{
+		dir:      dir,
+		interval: interval,
+		mem:      NewMemorySource(),
+	}
+}
+
+// refresh 扫描 prefix 对应的目录，把变更同步到内存中
+func (d *DirSource) refresh(ctx context.Context, prefix string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prefixDir := filepath.Join(d.dir, filepath.FromSlash(prefix))
+	entries, err := os.ReadDir(prefixDir)
+	if err != nil {
+		return fmt.Errorf("read source dir err: %w ", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(prefixDir, e.Name()))
+		if os.IsNotExist(err) {
+			// 扫描期间被删除了
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read source file err: %w ", err)
+		}
+		files[path.Join(prefix, e.Name())] = content
+	}
+
+	current, _, _ := d.mem.List(ctx, prefix)
+	currentMap := make(map[string][]byte, len(current))
+	for _, e := range current {
+		currentMap[e.Key] = e.Value
+	}
+
+	for k, v := range files {
+		if old, ok := currentMap[k]; !ok || !bytes.Equal(old, v) {
+			d.mem.Put(k, string(v))
+		}
+	}
+	for k := range currentMap {
+		if _, ok := files[k]; !ok {
+			d.mem.Delete(k)
+		}
+	}
+	return nil
+}
+
+func (d *DirSource) List(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	if err := d.refresh(ctx, prefix); err != nil {
+		return nil, 0, err
+	}
+	return d.mem.List(ctx, prefix)
+}
+
+// Get 只能获取到本进程扫描到过的历史版本
+func (d *DirSource) Get(ctx context.Context, key string, revision int64) (*KeyValue, error) {
+	if revision <= 0 {
+		if err := d.refresh(ctx, path.Dir(key)+"/"); err != nil {
+			return nil, err
+		}
+	}
+	return d.mem.Get(ctx, key, revision)
+}
+
+func (d *DirSource) Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse {
+	result := make(chan WatchResponse)
+
+	refreshErr := d.refresh(ctx, prefix)
+	ctx, cancel := context.WithCancel(ctx)
+	wc := d.mem.Watch(ctx, prefix, fromRevision)
+
+	go func() {
+		defer close(result)
+		defer cancel()
+
+		send := func(resp WatchResponse) bool {
+			select {
+			case result <- resp:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if refreshErr != nil {
+			send(WatchResponse{Err: refreshErr})
+			return
+		}
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case resp, ok := <-wc:
+				if !ok || !send(resp) {
+					return
+				}
+			case <-ticker.C:
+				if err := d.refresh(ctx, prefix); err != nil {
+					send(WatchResponse{Err: err})
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result
+}
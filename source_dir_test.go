@@ -0,0 +1,64 @@
+package sail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	nsDir := filepath.Join(dir, "conf", "test_project_key", "test")
+	require.NoError(t, os.MkdirAll(nsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(nsDir, "mysql.toml"), []byte("database=\"127.0.0.1:3306\""), 0644))
+
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml",
+	}, WithSource(NewDirSource(dir, 10*time.Millisecond)))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	err := sail.Pull()
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(nsDir, "mysql.toml"), []byte("database=\"0.0.0.0:3306\""), 0644))
+	assert.Eventually(t, func() bool {
+		return sail.MustGetString("database") == "0.0.0.0:3306"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(nsDir, "mysql.toml")))
+	assert.Eventually(t, func() bool {
+		return sail.GetViperWithName("mysql.toml") == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDirSource_Get(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	nsDir := filepath.Join(dir, "conf", "p", "dev")
+	require.NoError(t, os.MkdirAll(nsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(nsDir, "a.toml"), []byte("a=1"), 0644))
+
+	src := NewDirSource(dir, 0)
+	kv, err := src.Get(ctx, "/conf/p/dev/a.toml", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1", string(kv.Value))
+
+	require.NoError(t, os.WriteFile(filepath.Join(nsDir, "a.toml"), []byte("a=2"), 0644))
+	kv2, err := src.Get(ctx, "/conf/p/dev/a.toml", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "a=2", string(kv2.Value))
+
+	old, err := src.Get(ctx, "/conf/p/dev/a.toml", kv.ModRevision)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1", string(old.Value))
+}
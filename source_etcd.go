@@ -0,0 +1,109 @@
+package sail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdSource 默认的配置来源
+// etcdClient 在重连时会被替换，所以每次都从 Sail 中获取
+type etcdSource struct {
+	s *Sail
+}
+
+func newETCDSource(s *Sail) Source {
+	return &etcdSource{s: s}
+}
+
+func (e *etcdSource) List(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	getResp, err := e.s.etcdClient.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var revision int64
+	if getResp.Header != nil {
+		revision = getResp.Header.Revision
+	}
+	result := make([]*KeyValue, 0, len(getResp.Kvs))
+	for _, e := range getResp.Kvs {
+		result = append(result, toKeyValue(e))
+	}
+	return result, revision, nil
+}
+
+func (e *etcdSource) Get(ctx context.Context, key string, revision int64) (*KeyValue, error) {
+	var opts []clientv3.OpOption
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+	getResp, err := e.s.etcdClient.Get(ctx, key, opts...)
+	if errors.Is(err, rpctypes.ErrCompacted) {
+		return nil, fmt.Errorf("%w: %s at revision %d ", ErrSourceCompacted, key, revision)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(getResp.Kvs) == 0 {
+		return nil, fmt.Errorf("%w: %s ", ErrKeyNotFound, key)
+	}
+	return toKeyValue(getResp.Kvs[0]), nil
+}
+
+func (e *etcdSource) Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if fromRevision > 0 {
+		opts = append(opts, clientv3.WithRev(fromRevision))
+	}
+	wc := e.s.etcdClient.Watch(clientv3.WithRequireLeader(ctx), prefix, opts...)
+
+	result := make(chan WatchResponse)
+	go func() {
+		defer close(result)
+
+		for we := range wc {
+			resp := WatchResponse{}
+			if err := we.Err(); err != nil {
+				if errors.Is(err, rpctypes.ErrCompacted) {
+					err = fmt.Errorf("%w: compact revision %d ", ErrSourceCompacted, we.CompactRevision)
+				}
+				resp.Err = err
+			}
+			for _, ev := range we.Events {
+				eventType := EventPut
+				if ev.Type == mvccpb.DELETE {
+					eventType = EventDelete
+				}
+				resp.Events = append(resp.Events, &Event{Type: eventType, KV: toKeyValue(ev.Kv)})
+			}
+
+			select {
+			case result <- resp:
+			case <-ctx.Done():
+				return
+			}
+			if resp.Err != nil {
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// watchable 没有可用的 etcd 连接时，不启动监听
+func (e *etcdSource) watchable() bool {
+	return e.s.etcdClient != nil && e.s.etcdClient.Watcher != nil
+}
+
+func toKeyValue(kv *mvccpb.KeyValue) *KeyValue {
+	return &KeyValue{
+		Key:         string(kv.Key),
+		Value:       kv.Value,
+		ModRevision: kv.ModRevision,
+	}
+}
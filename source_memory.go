@@ -0,0 +1,216 @@
+package sail
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemorySource 内存中的配置来源，保留全部历史版本，用于测试和本地开发
+// 例：
+// src := sail.NewMemorySource()
+// src.Put("/conf/project/dev/mysql.toml", `database="127.0.0.1:3306"`)
+// s := sail.New(meta, sail.WithSource(src))
+type MemorySource struct {
+	mu       sync.Mutex
+	revision int64
+	compact  int64
+	history  []*Event // 按 revision 排序
+	watchers map[*memoryWatch]struct{}
+}
+
+const memoryWatchBuffer = 1024
+
+type memoryWatch struct {
+	prefix string
+	ch     chan WatchResponse
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		watchers: make(map[*memoryWatch]struct{}),
+	}
+}
+
+// Put 写入配置，返回新的 revision
+func (m *MemorySource) Put(key string, value string) int64 {
+	return m.append(EventPut, key, []byte(value))
+}
+
+// Delete 删除配置，返回新的 revision
+func (m *MemorySource) Delete(key string) int64 {
+	return m.append(EventDelete, key, nil)
+}
+
+// Compact 丢弃 revision 之前的历史版本，与 etcd 一致，revision 本身仍然可以读取和监听
+func (m *MemorySource) Compact(revision int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if revision > m.compact {
+		m.compact = revision
+	}
+}
+
+// Revision 当前的 revision
+func (m *MemorySource) Revision() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revision
+}
+
+func (m *MemorySource) append(eventType EventType, key string, value []byte) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revision++
+	ev := &Event{
+		Type: eventType,
+		KV: &KeyValue{
+			Key:         key,
+			Value:       value,
+			ModRevision: m.revision,
+		},
+	}
+	m.history = append(m.history, ev)
+
+	for w := range m.watchers {
+		if !strings.HasPrefix(key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- WatchResponse{Events: []*Event{copyEvent(ev)}}:
+		default:
+			// 监听者太慢，关闭它，由监听者从最后的 revision 重新监听
+			close(w.ch)
+			delete(m.watchers, w)
+		}
+	}
+	return m.revision
+}
+
+// copyKeyValue 返回给调用方的都是副本，调用方修改后不会改变历史版本
+func copyKeyValue(kv *KeyValue) *KeyValue {
+	c := *kv
+	c.Value = append([]byte(nil), kv.Value...)
+	return &c
+}
+
+func copyEvent(ev *Event) *Event {
+	return &Event{Type: ev.Type, KV: copyKeyValue(ev.KV)}
+}
+
+// snapshot revision 时所有存活的 key，调用方需持有锁
+func (m *MemorySource) snapshot(revision int64) map[string]*KeyValue {
+	result := make(map[string]*KeyValue)
+	for _, e := range m.history {
+		if e.KV.ModRevision > revision {
+			break
+		}
+		if e.Type == EventDelete {
+			delete(result, e.KV.Key)
+			continue
+		}
+		result[e.KV.Key] = e.KV
+	}
+	return result
+}
+
+func (m *MemorySource) List(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]*KeyValue, 0)
+	for k, v := range m.snapshot(m.revision) {
+		if strings.HasPrefix(k, prefix) {
+			result = append(result, copyKeyValue(v))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, m.revision, nil
+}
+
+func (m *MemorySource) Get(ctx context.Context, key string, revision int64) (*KeyValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if revision <= 0 {
+		revision = m.revision
+	}
+	if revision < m.compact {
+		return nil, fmt.Errorf("%w: compact revision %d ", ErrSourceCompacted, m.compact)
+	}
+	kv, ok := m.snapshot(revision)[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s ", ErrKeyNotFound, key)
+	}
+	return copyKeyValue(kv), nil
+}
+
+// Watch 监听者跟不上 memoryWatchBuffer 个变更时，channel 会被关闭
+func (m *MemorySource) Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(chan WatchResponse)
+
+	if fromRevision > 0 && fromRevision < m.compact {
+		compactErr := fmt.Errorf("%w: compact revision %d ", ErrSourceCompacted, m.compact)
+		go func() {
+			defer close(result)
+			select {
+			case result <- WatchResponse{Err: compactErr}:
+			case <-ctx.Done():
+			}
+		}()
+		return result
+	}
+
+	// 补发 fromRevision 之后的历史
+	var replay []*Event
+	if fromRevision > 0 {
+		for _, e := range m.history {
+			if e.KV.ModRevision >= fromRevision && strings.HasPrefix(e.KV.Key, prefix) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	w := &memoryWatch{
+		prefix: prefix,
+		ch:     make(chan WatchResponse, len(replay)+memoryWatchBuffer),
+	}
+	for _, e := range replay {
+		w.ch <- WatchResponse{Events: []*Event{copyEvent(e)}}
+	}
+	m.watchers[w] = struct{}{}
+
+	go func() {
+		defer close(result)
+		defer func() {
+			m.mu.Lock()
+			delete(m.watchers, w)
+			m.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case resp, ok := <-w.ch:
+				if !ok {
+					return
+				}
+				select {
+				case result <- resp:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result
+}
@@ -0,0 +1,126 @@
+package sail
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemorySource(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+	src.Put("/conf/test_project_key/test/redis.yaml", "host: 0.0.0.0")
+	src.Put("/conf/test_project_key/other/mysql.toml", "database=\"0.0.0.0:3306\"")
+	src.Delete("/conf/test_project_key/test/redis.yaml")
+
+	kvs, revision, err := src.List(ctx, "/conf/test_project_key/test/")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), revision)
+	require.Len(t, kvs, 1)
+	assert.Equal(t, "/conf/test_project_key/test/mysql.toml", kvs[0].Key)
+
+	kv, err := src.Get(ctx, "/conf/test_project_key/test/redis.yaml", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "host: 0.0.0.0", string(kv.Value))
+
+	// 修改返回值不影响历史版本
+	kv.Value[0] = 'x'
+	kvs[0].Value = nil
+	kv, err = src.Get(ctx, "/conf/test_project_key/test/redis.yaml", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "host: 0.0.0.0", string(kv.Value))
+	kvs, _, err = src.List(ctx, "/conf/test_project_key/test/")
+	require.NoError(t, err)
+	assert.Equal(t, "database=\"127.0.0.1:3306\"", string(kvs[0].Value))
+
+	_, err = src.Get(ctx, "/conf/test_project_key/test/redis.yaml", 0)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	t.Run("WatchFromRevision", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		wc := src.Watch(ctx, "/conf/test_project_key/test/", 2)
+		resp := <-wc
+		assert.Equal(t, int64(2), resp.Events[0].KV.ModRevision)
+		resp = <-wc
+		assert.Equal(t, EventDelete, resp.Events[0].Type)
+
+		src.Put("/conf/test_project_key/test/mysql.toml", "database=\"10.0.0.1:3306\"")
+		resp = <-wc
+		assert.Equal(t, "database=\"10.0.0.1:3306\"", string(resp.Events[0].KV.Value))
+	})
+
+	t.Run("WatchCompacted", func(t *testing.T) {
+		src.Compact(3)
+		resp, ok := <-src.Watch(ctx, "/conf/test_project_key/test/", 2)
+		require.Equal(t, true, ok)
+		assert.ErrorIs(t, resp.Err, ErrSourceCompacted)
+
+		_, err := src.Get(ctx, "/conf/test_project_key/test/redis.yaml", 2)
+		assert.ErrorIs(t, err, ErrSourceCompacted)
+
+		// 压缩的 revision 本身仍然可以读取和监听
+		kv, err := src.Get(ctx, "/conf/test_project_key/test/redis.yaml", 3)
+		require.NoError(t, err)
+		assert.Equal(t, "host: 0.0.0.0", string(kv.Value))
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		resp, ok = <-src.Watch(watchCtx, "/conf/test_project_key/test/", 3)
+		require.Equal(t, true, ok)
+		require.NoError(t, resp.Err)
+		assert.Equal(t, int64(4), resp.Events[0].KV.ModRevision)
+	})
+}
+
+func TestSail_WithMemorySource(t *testing.T) {
+	src := NewMemorySource()
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml",
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+
+	err := sail.Pull()
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"0.0.0.0:3306\"")
+	assert.Eventually(t, func() bool {
+		return sail.MustGetString("database") == "0.0.0.0:3306"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSail_PullPublishWithMemorySource(t *testing.T) {
+	key := "/conf/test_project_key/test/mysql.toml"
+	src := NewMemorySource()
+	release := src.Put(key, "database=\"127.0.0.1:3306\"")
+	publish := src.Put(key, fmt.Sprintf("PUBLISH&THIS_IS_TOKEN&1&%d&SecretData==", release))
+
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml",
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.pullETCDConfig())
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+
+	// 解析 PUBLISH 不会改写配置来源中的记录
+	kv, err := src.Get(context.Background(), key, publish)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("PUBLISH&THIS_IS_TOKEN&1&%d&SecretData==", release), string(kv.Value))
+}
@@ -0,0 +1,151 @@
+package sail
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ConnState 与配置来源的连接状态
+type ConnState string
+
+const (
+	// StateConnecting 还没有从配置来源拉取成功
+	StateConnecting ConnState = "connecting"
+	// StateConnected 已经从配置来源拉取成功
+	StateConnected ConnState = "connected"
+	// StateReconnecting 连接或拉取失败，正在后台重连，期间使用本地备份文件中的配置
+	StateReconnecting ConnState = "reconnecting"
+	// StateClosed 已经调用 Close
+	StateClosed ConnState = "closed"
+)
+
+// Status 客户端的运行状况
+type Status struct {
+	State      ConnState               `json:"state"`
+	Origins    map[string]ConfigOrigin `json:"origins"`      // 每个配置的来源
+	Revision   int64                   `json:"revision"`     // 最后一次应用的 etcd revision
+	LastSyncAt time.Time               `json:"last_sync_at"` // 最后一次从配置来源拉取或收到变更的时间
+	LastError  error                   `json:"-"`            // 最后一次后台错误，如连接、解密、写入备份失败
+	LastErrAt  time.Time               `json:"last_error_at,omitempty"`
+	Watch      WatchHealth             `json:"-"`
+}
+
+// Live 客户端没有关闭
+func (st Status) Live() bool {
+	return st.State != StateClosed
+}
+
+// Ready 已经有配置可用：从配置来源拉取成功，或正在使用本地备份文件
+func (st Status) Ready() bool {
+	switch st.State {
+	case StateConnected:
+		return true
+	case StateClosed:
+		return false
+	default:
+		return len(st.Origins) > 0
+	}
+}
+
+// Status 当前的运行状况
+func (s *Sail) Status() Status {
+	if s.err != nil {
+		// New 失败
+		return Status{State: StateClosed, LastError: s.err}
+	}
+	st := Status{
+		Origins:  s.ConfigOrigins(),
+		Revision: s.loadRevision(),
+		Watch:    s.WatchHealth(),
+	}
+
+	s.statusLock.Lock()
+	st.LastSyncAt = s.lastPullAt
+	st.LastError = s.lastErr
+	st.LastErrAt = s.lastErrAt
+	s.statusLock.Unlock()
+	if st.Watch.LastEventAt.After(st.LastSyncAt) {
+		st.LastSyncAt = st.Watch.LastEventAt
+	}
+
+	switch {
+	case s.ctx.Err() != nil:
+		st.State = StateClosed
+	case atomic.LoadInt32(&s.reconnecting) == 1:
+		st.State = StateReconnecting
+	case s.Synced():
+		st.State = StateConnected
+	default:
+		st.State = StateConnecting
+	}
+	return st
+}
+
+func (s *Sail) setLastError(err error) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.lastErr = err
+	s.lastErrAt = time.Now()
+}
+
+func (s *Sail) setLastPull() {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.lastPullAt = time.Now()
+}
+
+// HealthHandler 用于存活和就绪探针的 http.Handler，响应体都是 JSON 格式的 Status
+// /livez   Close 后返回 503
+// /readyz  没有可用的配置时返回 503
+// 其他路径总是返回 200
+func (s *Sail) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		st := s.Status()
+		writeStatus(w, st, st.Live())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		st := s.Status()
+		writeStatus(w, st, st.Ready())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, s.Status(), true)
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, st Status, ok bool) {
+	body := struct {
+		Status
+		LastError string      `json:"last_error,omitempty"`
+		Watch     watchStatus `json:"watch"`
+	}{
+		Status: st,
+		Watch: watchStatus{
+			Running:     st.Watch.Running,
+			Restarts:    st.Watch.Restarts,
+			LastEventAt: st.Watch.LastEventAt,
+		},
+	}
+	if st.LastError != nil {
+		body.LastError = st.LastError.Error()
+	}
+	if st.Watch.LastError != nil {
+		body.Watch.LastError = st.Watch.LastError.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type watchStatus struct {
+	Running     bool      `json:"running"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastEventAt time.Time `json:"last_event_at"`
+}
@@ -0,0 +1,78 @@
+package sail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSail_Status(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql.toml"), []byte("database=\"local\""), 0644))
+	src := &flakySource{MemorySource: NewMemorySource(), down: 1}
+	rev := src.Put("/conf/test_project_key/test/mysql.toml", "database=\"remote\"")
+
+	sail := New(&MetaConfig{
+		LogLevel:       "DEBUG",
+		ProjectKey:     "test_project_key",
+		Namespace:      "test",
+		Configs:        "mysql.toml",
+		ConfigFilePath: dir,
+	}, WithSource(src), WithRetryPolicy(RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Multiplier:     1,
+	}))
+	require.NoError(t, sail.Err())
+	handler := sail.HealthHandler()
+	probe := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		body := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	st := sail.Status()
+	assert.Equal(t, StateConnecting, st.State)
+	assert.False(t, st.Ready())
+	code, _ := probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// 拉取失败，使用本地备份文件
+	require.NoError(t, sail.Pull())
+	st = sail.Status()
+	assert.Equal(t, StateReconnecting, st.State)
+	assert.Equal(t, map[string]ConfigOrigin{"mysql.toml": OriginLocal}, st.Origins)
+	assert.Error(t, st.LastError)
+	assert.True(t, st.Ready())
+	code, body := probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "reconnecting", body["state"])
+	assert.Contains(t, body["last_error"], "permission denied")
+
+	atomic.StoreInt32(&src.down, 0)
+	assert.Eventually(t, func() bool {
+		return sail.Status().State == StateConnected
+	}, time.Second, 10*time.Millisecond)
+	st = sail.Status()
+	assert.Equal(t, rev, st.Revision)
+	assert.Equal(t, OriginRemote, st.Origins["mysql.toml"])
+	assert.False(t, st.LastSyncAt.IsZero())
+	code, body = probe("/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "connected", body["state"])
+
+	require.NoError(t, sail.Close())
+	assert.Equal(t, StateClosed, sail.Status().State)
+	code, _ = probe("/livez")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
@@ -0,0 +1,174 @@
+package sail
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type ChangeType int
+
+const (
+	KeyAdded ChangeType = iota + 1
+	KeyModified
+	KeyRemoved
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case KeyAdded:
+		return "added"
+	case KeyModified:
+		return "modified"
+	case KeyRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// KeyChange 某个配置项的变更
+type KeyChange struct {
+	ConfigFileKey string
+	Key           string
+	Type          ChangeType
+	OldValue      interface{} // KeyAdded 时为 nil
+	NewValue      interface{} // KeyRemoved 时为 nil
+	Revision      int64       // 触发变更的 etcd revision
+}
+
+type OnKeyChange func(ev KeyChange)
+
+type subscription struct {
+	id            int
+	configFileKey string
+	pattern       []string
+	fn            OnKeyChange
+}
+
+// Subscribe 订阅配置项的变更，仅在匹配的配置项确实发生变化时回调
+// pattern 以 . 分隔，* 匹配任意一段，末尾的 * 匹配剩余的所有段。
+// 例：
+// db.pool.max  只匹配 db.pool.max
+// db.*.max     匹配 db.pool.max、db.conn.max
+// db.pool.*    匹配 db.pool 下的所有配置项
+// 返回的函数用于取消订阅。
+func (s *Sail) Subscribe(configFileKey string, pattern string, fn OnKeyChange) (unsubscribe func()) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+
+	s.subID++
+	sub := &subscription{
+		id:            s.subID,
+		configFileKey: configFileKey,
+		pattern:       strings.Split(strings.ToLower(pattern), "."),
+		fn:            fn,
+	}
+	s.subscriptions = append(s.subscriptions, sub)
+
+	return func() {
+		s.subLock.Lock()
+		defer s.subLock.Unlock()
+
+		for i, e := range s.subscriptions {
+			if e.id == sub.id {
+				s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (sub *subscription) match(key string) bool {
+	keySp := strings.Split(key, ".")
+	for i, p := range sub.pattern {
+		if p == "*" && i == len(sub.pattern)-1 {
+			return len(keySp) > i
+		}
+		if i >= len(keySp) {
+			return false
+		}
+		if p != "*" && p != keySp[i] {
+			return false
+		}
+	}
+	return len(keySp) == len(sub.pattern)
+}
+
+// notifyKeyChange 对比新旧 viper，把变更推给订阅者
+func (s *Sail) notifyKeyChange(configFileKey string, oldViper, newViper *viper.Viper, revision int64) {
+	s.subLock.Lock()
+	subs := make([]*subscription, 0, len(s.subscriptions))
+	for _, e := range s.subscriptions {
+		if e.configFileKey == configFileKey {
+			subs = append(subs, e)
+		}
+	}
+	s.subLock.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	changes := diffVipers(configFileKey, oldViper, newViper, revision)
+	for _, c := range changes {
+		for _, sub := range subs {
+			if sub.match(c.Key) {
+				sub.fn(c)
+			}
+		}
+	}
+}
+
+func diffVipers(configFileKey string, oldViper, newViper *viper.Viper, revision int64) []KeyChange {
+	oldSettings := flattenViper(oldViper)
+	newSettings := flattenViper(newViper)
+
+	keys := make([]string, 0, len(oldSettings)+len(newSettings))
+	for k := range oldSettings {
+		keys = append(keys, k)
+	}
+	for k := range newSettings {
+		if _, ok := oldSettings[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var result []KeyChange
+	for _, k := range keys {
+		oldValue, inOld := oldSettings[k]
+		newValue, inNew := newSettings[k]
+
+		c := KeyChange{
+			ConfigFileKey: configFileKey,
+			Key:           k,
+			OldValue:      oldValue,
+			NewValue:      newValue,
+			Revision:      revision,
+		}
+		switch {
+		case inOld && !inNew:
+			c.Type = KeyRemoved
+		case !inOld && inNew:
+			c.Type = KeyAdded
+		case !reflect.DeepEqual(oldValue, newValue):
+			c.Type = KeyModified
+		default:
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+func flattenViper(v *viper.Viper) map[string]interface{} {
+	result := make(map[string]interface{})
+	if v == nil {
+		return result
+	}
+	for _, k := range v.AllKeys() {
+		result[k] = v.Get(k)
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package sail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func Test_subscription_match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{pattern: "db.pool.max", key: "db.pool.max", want: true},
+		{pattern: "db.pool.max", key: "db.pool", want: false},
+		{pattern: "db.*.max", key: "db.pool.max", want: true},
+		{pattern: "db.*.max", key: "db.pool.min", want: false},
+		{pattern: "db.pool.*", key: "db.pool.max", want: true},
+		{pattern: "db.pool.*", key: "db.pool.conn.max", want: true},
+		{pattern: "db.pool.*", key: "db.pool", want: false},
+		{pattern: "DB.Pool.*", key: "db.pool.max", want: true},
+		{pattern: "*", key: "database", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"-"+tt.key, func(t *testing.T) {
+			s := &Sail{}
+			s.Subscribe("mysql.toml", tt.pattern, nil)
+			assert.Equal(t, tt.want, s.subscriptions[0].match(tt.key))
+		})
+	}
+}
+
+func TestSail_Subscribe(t *testing.T) {
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		LogLevel:      "DEBUG",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+		NamespaceKey:  "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD",
+	})
+	sail.configs = []string{"mysql.toml"}
+	sail.etcdClient = &clientv3.Client{
+		KV: &mockKV{KV: clientv3.NewKVFromKVClient(nil, nil), response: &clientv3.GetResponse{
+			Kvs: []*mvccpb.KeyValue{
+				{
+					Key:   []byte("/conf/test_project_key/test/mysql.toml"),
+					Value: []byte("database=\"127.0.0.1:3306\"\n[pool]\nmax=10\nmin=1"),
+				},
+			},
+		}},
+	}
+
+	var poolChanges, dbChanges []KeyChange
+	sail.Subscribe("mysql.toml", "pool.*", func(ev KeyChange) {
+		poolChanges = append(poolChanges, ev)
+	})
+	unsubscribe := sail.Subscribe("mysql.toml", "database", func(ev KeyChange) {
+		dbChanges = append(dbChanges, ev)
+	})
+
+	err := sail.pullETCDConfig()
+	require.NoError(t, err)
+	assert.Empty(t, poolChanges)
+
+	ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+	ee.dealETCDMsg("/conf/test_project_key/test/mysql.toml", []byte("database=\"127.0.0.1:3306\"\n[pool]\nmax=20\nidle=5"), 7)
+
+	assert.Empty(t, dbChanges)
+	require.Len(t, poolChanges, 3)
+	assert.Equal(t, KeyChange{ConfigFileKey: "mysql.toml", Key: "pool.idle", Type: KeyAdded, NewValue: int64(5), Revision: 7}, poolChanges[0])
+	assert.Equal(t, KeyChange{ConfigFileKey: "mysql.toml", Key: "pool.max", Type: KeyModified, OldValue: int64(10), NewValue: int64(20), Revision: 7}, poolChanges[1])
+	assert.Equal(t, KeyChange{ConfigFileKey: "mysql.toml", Key: "pool.min", Type: KeyRemoved, OldValue: int64(1), Revision: 7}, poolChanges[2])
+
+	unsubscribe()
+	ee.dealETCDMsg("/conf/test_project_key/test/mysql.toml", []byte("database=\"0.0.0.0:3306\""), 8)
+	assert.Empty(t, dbChanges)
+}
@@ -2,13 +2,31 @@ package sail
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
 
-	"go.etcd.io/etcd/api/v3/mvccpb"
-	clientv3 "go.etcd.io/etcd/client/v3"
+var (
+	ErrWatchClosed = errors.New("ErrWatchClosed")
 )
 
+// watchRetryInterval 监听中断后，重新监听的间隔
+var watchRetryInterval = time.Second
+
 type Watcher interface {
 	Run()
+	Health() WatchHealth
+}
+
+// WatchHealth 监听的健康状况
+type WatchHealth struct {
+	Running     bool      // 监听协程是否在运行
+	Revision    int64     // 最后一次应用的 etcd revision
+	Restarts    int       // 重新监听的次数
+	LastError   error     // 最后一次监听中断的原因
+	LastEventAt time.Time // 最后一次收到事件的时间
 }
 
 type etcdWatcher struct {
@@ -16,6 +34,12 @@ type etcdWatcher struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	running     bool
+	restarts    int
+	lastErr     error
+	lastEventAt time.Time
 }
 
 func NewWatcher(ctx context.Context, s *Sail) Watcher {
@@ -29,63 +53,245 @@ func NewWatcher(ctx context.Context, s *Sail) Watcher {
 	return etcdW
 }
 
+// Run 启动监听，重复调用不会启动多个监听
+// 监听中断后会从最后一次应用的 revision+1 处重新监听，
+// 如果该 revision 已被压缩，则先全量拉取一次配置。
 func (e *etcdWatcher) Run() {
-	if e.s.etcdClient.Watcher == nil {
+	if es, ok := e.s.source.(*etcdSource); ok && !es.watchable() {
+		return
+	}
+
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
 		return
 	}
+	e.running = true
+	e.mu.Unlock()
+
+	go e.supervise()
+}
+
+func (e *etcdWatcher) Health() WatchHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return WatchHealth{
+		Running:     e.running,
+		Revision:    e.s.loadRevision(),
+		Restarts:    e.restarts,
+		LastError:   e.lastErr,
+		LastEventAt: e.lastEventAt,
+	}
+}
+
+func (e *etcdWatcher) supervise() {
+	defer func() {
+		e.mu.Lock()
+		e.running = false
+		e.mu.Unlock()
+	}()
 
-	wc := e.s.etcdClient.Watch(
-		e.ctx,
-		e.s.getETCDKeyPrefix(),
-		clientv3.WithPrefix(),
-	)
-
-	go func() {
-		for {
-			select {
-			case we := <-wc:
-				for _, ev := range we.Events {
-					switch ev.Type {
-					case mvccpb.PUT:
-						isPublish, _ := e.s.checkPublish(ev.Kv.Value)
-						if isPublish {
-							// 忽略 Publish 消息推送
-							continue
-						}
-
-						e.dealETCDMsg(string(ev.Kv.Key), ev.Kv.Value)
-					case mvccpb.DELETE:
-						//do nothing with delete event
-					}
+	for {
+		err := e.watch()
+		if e.ctx.Err() != nil {
+			e.s.l.Info("close etcd watch, bye~ ")
+			return
+		}
+		e.s.l.Warn("etcd watch interrupted, rewatch later. ", "err", err, "revision", e.s.loadRevision())
+
+		if errors.Is(err, ErrSourceCompacted) {
+			// 需要的 revision 已被压缩，只能全量拉取
+			if resyncErr := e.s.loadETCDConfig(); resyncErr != nil {
+				e.s.l.Error("resync etcd config fail. ", "err", resyncErr)
+				err = fmt.Errorf("%v, resync fail: %w ", err, resyncErr)
+			}
+		}
+
+		e.mu.Lock()
+		e.lastErr = err
+		e.restarts++
+		e.mu.Unlock()
+
+		select {
+		case <-e.ctx.Done():
+			e.s.l.Info("close etcd watch, bye~ ")
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// watch 监听直到出错，总是返回非 nil 的 error
+func (e *etcdWatcher) watch() error {
+	var fromRevision int64
+	if rev := e.s.loadRevision(); rev > 0 {
+		fromRevision = rev + 1
+	}
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	wc := e.s.source.Watch(ctx, e.s.getETCDKeyPrefix(), fromRevision)
+
+	for {
+		select {
+		case we, ok := <-wc:
+			if !ok {
+				return ErrWatchClosed
+			}
+			for _, ev := range we.Events {
+				var applied bool
+				var err error
+				switch ev.Type {
+				case EventPut:
+					applied, err = e.dealETCDPut(ev.KV)
+				case EventDelete:
+					applied = e.dealETCDDelete(ev.KV.Key, ev.KV.ModRevision)
+				}
+				if err != nil {
+					// 不推进 revision，重新监听时从这个事件开始
+					return fmt.Errorf("deal event %s at revision %d err: %w ", ev.KV.Key, ev.KV.ModRevision, err)
 				}
-			case <-e.ctx.Done():
-				e.s.l.Info("close etcd watch, bye~ ")
-				return
+				e.s.metrics.IncWatchEvent(getConfigFileKeyFrom(ev.KV.Key), applied)
+				e.s.storeRevision(ev.KV.ModRevision)
 			}
+			if len(we.Events) > 0 {
+				e.mu.Lock()
+				e.lastEventAt = time.Now()
+				e.mu.Unlock()
+			}
+			if we.Err != nil {
+				return we.Err
+			}
+		case <-e.ctx.Done():
+			return e.ctx.Err()
 		}
-	}()
+	}
+}
+
+// dealETCDPut PUBLISH 记录会被解析为它指向的版本的配置内容，返回变更是否被应用
+// 读取指向的版本时遇到暂时性错误会返回 error，此时该事件需要重试
+func (e *etcdWatcher) dealETCDPut(kv *KeyValue) (bool, error) {
+	configFileKey := getConfigFileKeyFrom(kv.Key)
+	if !e.s.isConfigWatched(configFileKey) {
+		e.s.l.Debug("ignore the config not in configs. ", "key", kv.Key)
+		return false, nil
+	}
+
+	if _, isPublish := parsePublish(kv.Value); isPublish {
+		e.s.setPublished(configFileKey, true)
+	} else if e.s.metaConfig.PublishOnly || e.s.isPublished(configFileKey) {
+		// 草稿，等待 PUBLISH 记录，与重启后拉取的结果一致
+		e.s.l.Debug("ignore the unpublished config. ", "key", kv.Key)
+		return false, nil
+	}
+
+	value, err := e.s.resolvePublish(kv)
+	if errors.Is(err, ErrNotTargeted) {
+		e.s.l.Info("this instance is not in the gray release, skip it. ", "key", kv.Key)
+		return false, nil
+	}
+	if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrSourceCompacted) {
+		// 指向的版本已不存在，重试也无法读取
+		e.s.l.Error("read publish config fail, keep the last value. ", "err", err, "key", kv.Key)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read publish config err: %w ", err)
+	}
+	return e.dealETCDMsg(kv.Key, value, kv.ModRevision), nil
 }
 
-func (e *etcdWatcher) dealETCDMsg(key string, value []byte) {
+func (e *etcdWatcher) dealETCDMsg(key string, value []byte, revision int64) bool {
 	e.s.l.Debug("got a event by: ", "key", key)
 	if len(value) == 0 {
-		return
+		return false
 	}
 	configFileKey := getConfigFileKeyFrom(key)
+	if !e.s.isConfigWatched(configFileKey) {
+		e.s.l.Debug("ignore the config not in configs. ", "key", configFileKey)
+		return false
+	}
 
-	viperETCD, err := e.s.newViperWithETCDValue(configFileKey, value)
+	viperETCD, raw, err := e.s.newViperWithETCDValue(configFileKey, value, e.s.keyring())
+	var derr *DecryptError
+	if errors.As(err, &derr) {
+		// 不打印密文，保留旧配置
+		e.s.l.Error("decrypt config fail, keep the last value. ", "key", configFileKey, "err", derr.Err)
+		e.s.reportError(derr)
+		return false
+	}
 	if err != nil {
 		e.s.l.Error("deal msg error: ", "err", err, "key", configFileKey, "value", string(value))
-		return
+		return false
 	}
 
 	e.s.lock.Lock()
+	oldViper := e.s.vipers[configFileKey]
 	e.s.vipers[configFileKey] = viperETCD
+	e.s.raws[configFileKey] = raw
+	e.s.revisions[configFileKey] = revision
+	e.s.origins[configFileKey] = OriginRemote
+	// 新的发布解除回滚
+	delete(e.s.pins, configFileKey)
 	e.s.lock.Unlock()
+	e.s.metrics.SetConfigUpdated(configFileKey, time.Now())
+	e.s.refreshBindings(configFileKey)
+	e.s.notifyKeyChange(configFileKey, oldViper, viperETCD, revision)
 
 	e.s.fm.asyncWriteConfigFile(configFileKey)
 
 	if e.s.changeFunc != nil {
 		e.s.changeFunc(key, e.s)
 	}
+	return true
+}
+
+// dealETCDDelete 返回内存中的配置是否被删除
+func (e *etcdWatcher) dealETCDDelete(key string, revision int64) bool {
+	e.s.l.Debug("got a delete event by: ", "key", key)
+	configFileKey := getConfigFileKeyFrom(key)
+	if !e.s.isConfigWatched(configFileKey) {
+		e.s.l.Debug("ignore the config not in configs. ", "key", configFileKey)
+		return false
+	}
+	return e.s.deleteConfig(key, revision)
+}
+
+// deleteConfig 按 DeletePolicy 处理配置来源中被删除的配置，返回内存中的配置是否被删除
+// watch 收到删除事件，或全量拉取时配置已不存在，都由这里处理
+func (s *Sail) deleteConfig(key string, revision int64) bool {
+	configFileKey := getConfigFileKeyFrom(key)
+	// 重新创建的配置从第一个版本开始
+	s.setPublished(configFileKey, false)
+
+	removed := false
+	if s.deletePolicy == DeletePolicyKeep {
+		s.l.Warn("config was deleted in etcd, keep the last value. ", "key", configFileKey)
+	} else {
+		s.lock.Lock()
+		oldViper, ok := s.vipers[configFileKey]
+		delete(s.vipers, configFileKey)
+		delete(s.raws, configFileKey)
+		delete(s.revisions, configFileKey)
+		delete(s.pins, configFileKey)
+		delete(s.origins, configFileKey)
+		s.lock.Unlock()
+		if !ok {
+			return false
+		}
+		removed = true
+		s.metrics.SetConfigUpdated(configFileKey, time.Time{})
+		s.resetBindings(configFileKey)
+		s.markKeyUsage(configFileKey, "")
+		s.setDecryptError(configFileKey, nil)
+		s.notifyKeyChange(configFileKey, oldViper, nil, revision)
+
+		s.fm.asyncRemoveConfigFile(configFileKey)
+	}
+
+	if s.removeFunc != nil {
+		s.removeFunc(key, s)
+	}
+	return removed
 }
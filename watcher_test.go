@@ -1,11 +1,21 @@
 package sail
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/pkg/v3/fileutil"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -67,7 +77,7 @@ func Test_etcdWatcher_dealETCDMsg(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, "6379", port)
 
-			ee.dealETCDMsg(tt.replaceConfig, []byte(tt.replaceContent))
+			ee.dealETCDMsg(tt.replaceConfig, []byte(tt.replaceContent), 2)
 
 			db2, err := sail.GetString("database")
 			require.NoError(t, err)
@@ -83,3 +93,410 @@ func Test_etcdWatcher_dealETCDMsg(t *testing.T) {
 		})
 	}
 }
+
+func Test_etcdWatcher_dealETCDDelete(t *testing.T) {
+	response := &clientv3.GetResponse{
+		Kvs: []*mvccpb.KeyValue{
+			{
+				Key:   []byte("/conf/test_project_key/test/mysql.toml"),
+				Value: []byte("database=\"127.0.0.1:3306\""),
+			},
+			{
+				Key:   []byte("/conf/test_project_key/test/redis.properties"),
+				Value: []byte("I9IfkJSBekxeYbQJSX6zQsvZJwlfj3VyZ6RrtRF4LFI="),
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		deletePolicy DeletePolicy
+		wantExist    bool
+	}{
+		{
+			name:         "TESTRemove",
+			deletePolicy: DeletePolicyRemove,
+			wantExist:    false,
+		},
+		{
+			name:         "TESTKeep",
+			deletePolicy: DeletePolicyKeep,
+			wantExist:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempTest := t.TempDir()
+			var removed []string
+			sail := New(&MetaConfig{
+				ETCDEndpoints:  "127.0.0.1:2379",
+				LogLevel:       "DEBUG",
+				ProjectKey:     "test_project_key",
+				Namespace:      "test",
+				NamespaceKey:   "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD",
+				ConfigFilePath: tempTest,
+			}, WithDeletePolicy(tt.deletePolicy), WithOnConfigRemove(func(configFileKey string, s *Sail) {
+				removed = append(removed, configFileKey)
+			}))
+			sail.configs = []string{"mysql.toml", "redis.properties"}
+			sail.etcdClient = &clientv3.Client{
+				KV: &mockKV{KV: clientv3.NewKVFromKVClient(nil, nil), response: response},
+			}
+			err := sail.pullETCDConfig()
+			require.NoError(t, err)
+
+			var changes []KeyChange
+			sail.Subscribe("mysql.toml", "*", func(ev KeyChange) {
+				changes = append(changes, ev)
+			})
+
+			ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+			ee.dealETCDDelete("/conf/test_project_key/test/mysql.toml", 3)
+
+			assert.Equal(t, []string{"/conf/test_project_key/test/mysql.toml"}, removed)
+			_, ok := sail.vipers["mysql.toml"]
+			assert.Equal(t, tt.wantExist, ok)
+
+			if tt.wantExist {
+				assert.Empty(t, changes)
+				assert.FileExists(t, filepath.Join(tempTest, "mysql.toml"))
+				return
+			}
+			require.Len(t, changes, 1)
+			assert.Equal(t, KeyRemoved, changes[0].Type)
+			assert.Equal(t, "database", changes[0].Key)
+			assert.Eventually(t, func() bool {
+				return !fileutil.Exist(filepath.Join(tempTest, "mysql.toml"))
+			}, time.Second, 10*time.Millisecond)
+			assert.FileExists(t, filepath.Join(tempTest, "redis.properties"))
+		})
+	}
+}
+
+type mockWatcher struct {
+	clientv3.Watcher
+	responses []clientv3.WatchResponse
+
+	mu   sync.Mutex
+	revs []int64
+}
+
+// Watch 每次调用推送一个 response 后关闭 channel，推送完后阻塞到 ctx 结束
+func (w *mockWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.revs = append(w.revs, clientv3.OpGet(key, opts...).Rev())
+	wc := make(chan clientv3.WatchResponse, 1)
+	if len(w.revs) <= len(w.responses) {
+		wc <- w.responses[len(w.revs)-1]
+		close(wc)
+	}
+	return wc
+}
+
+func (w *mockWatcher) watchRevs() []int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]int64{}, w.revs...)
+}
+
+func Test_etcdWatcher_Run(t *testing.T) {
+	watchRetryInterval = time.Millisecond
+
+	response := &clientv3.GetResponse{
+		Header: &etcdserverpb.ResponseHeader{Revision: 10},
+		Kvs: []*mvccpb.KeyValue{
+			{
+				Key:   []byte("/conf/test_project_key/test/mysql.toml"),
+				Value: []byte("database=\"127.0.0.1:3306\""),
+			},
+		},
+	}
+	mw := &mockWatcher{
+		responses: []clientv3.WatchResponse{
+			{
+				Events: []*clientv3.Event{
+					{
+						Type: mvccpb.PUT,
+						Kv: &mvccpb.KeyValue{
+							Key:         []byte("/conf/test_project_key/test/mysql.toml"),
+							Value:       []byte("database=\"0.0.0.0:3306\""),
+							ModRevision: 12,
+						},
+					},
+				},
+			},
+			{CompactRevision: 15},
+		},
+	}
+
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		LogLevel:      "DEBUG",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+		NamespaceKey:  "NTUZNTNQNUKYEL4GP5SGVDV9LEYZAWBD",
+	})
+	defer sail.cancel()
+	sail.configs = []string{"mysql.toml"}
+	sail.etcdClient = &clientv3.Client{
+		KV:      &mockKV{KV: clientv3.NewKVFromKVClient(nil, nil), response: response},
+		Watcher: mw,
+	}
+	err := sail.pullETCDConfig()
+	require.NoError(t, err)
+
+	// 1. 从 10+1 开始监听，收到 12 后 channel 关闭
+	// 2. 从 12+1 重新监听，遇到压缩，全量拉取后 revision 回到 max(12, 10)
+	// 3. 从 12+1 重新监听
+	require.Eventually(t, func() bool {
+		return len(mw.watchRevs()) >= 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []int64{11, 13, 13}, mw.watchRevs()[:3])
+
+	// 全量拉取后，配置回到 etcd 中的值
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+
+	health := sail.WatchHealth()
+	assert.Equal(t, true, health.Running)
+	assert.Equal(t, int64(12), health.Revision)
+	assert.Equal(t, 2, health.Restarts)
+	assert.ErrorIs(t, health.LastError, ErrSourceCompacted)
+}
+
+func Test_etcdWatcher_filterConfigs(t *testing.T) {
+	tests := []struct {
+		name           string
+		watchNamespace bool
+		wantExist      bool
+	}{
+		{
+			name:           "TESTIgnore",
+			watchNamespace: false,
+			wantExist:      false,
+		},
+		{
+			name:           "TESTWatchNamespace",
+			watchNamespace: true,
+			wantExist:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempTest := t.TempDir()
+			sail := New(&MetaConfig{
+				ETCDEndpoints:  "127.0.0.1:2379",
+				LogLevel:       "DEBUG",
+				ProjectKey:     "test_project_key",
+				Namespace:      "test",
+				ConfigFilePath: tempTest,
+			}, WithWatchNamespace(tt.watchNamespace))
+			sail.configs = []string{"mysql.toml"}
+			sail.etcdClient = &clientv3.Client{
+				KV: &mockKV{KV: clientv3.NewKVFromKVClient(nil, nil), response: &clientv3.GetResponse{
+					Kvs: []*mvccpb.KeyValue{
+						{
+							Key:   []byte("/conf/test_project_key/test/mysql.toml"),
+							Value: []byte("database=\"127.0.0.1:3306\""),
+						},
+					},
+				}},
+			}
+			err := sail.pullETCDConfig()
+			require.NoError(t, err)
+
+			ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+			ee.dealETCDMsg("/conf/test_project_key/test/other.toml", []byte("database=\"0.0.0.0:3306\""), 3)
+
+			_, ok := sail.vipers["other.toml"]
+			assert.Equal(t, tt.wantExist, ok)
+			_, err = sail.Get("database")
+			if tt.wantExist {
+				assert.Error(t, err)
+				// 等待异步写入备份文件结束
+				assert.Eventually(t, func() bool {
+					manifest, err := ReadManifest(tempTest)
+					return err == nil && manifest.Files["other.toml"] != nil
+				}, time.Second, 10*time.Millisecond)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoFileExists(t, filepath.Join(tempTest, "other.toml"))
+		})
+	}
+}
+
+type mockRevKV struct {
+	clientv3.KV
+	values map[int64]string
+}
+
+func (kv *mockRevKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	// 与 etcd 一致，返回 revision 不大于 rev 的最新值
+	rev := clientv3.OpGet(key, opts...).Rev()
+	var modRevision int64
+	for e := range kv.values {
+		if e <= rev && e > modRevision {
+			modRevision = e
+		}
+	}
+	if modRevision == 0 {
+		return &clientv3.GetResponse{}, nil
+	}
+	return &clientv3.GetResponse{
+		Kvs: []*mvccpb.KeyValue{
+			{Key: []byte(key), Value: []byte(kv.values[modRevision]), ModRevision: modRevision},
+		},
+	}, nil
+}
+
+func Test_etcdWatcher_dealETCDPut(t *testing.T) {
+	sail := New(&MetaConfig{
+		ETCDEndpoints: "127.0.0.1:2379",
+		LogLevel:      "DEBUG",
+		ProjectKey:    "test_project_key",
+		Namespace:     "test",
+	})
+	sail.configs = []string{"mysql.toml"}
+	sail.etcdClient = &clientv3.Client{
+		KV: &mockRevKV{KV: clientv3.NewKVFromKVClient(nil, nil), values: map[int64]string{
+			5: "database=\"10.0.0.5:3306\"",
+		}},
+	}
+	ee := NewWatcher(sail.ctx, sail).(*etcdWatcher)
+
+	ee.dealETCDPut(&KeyValue{
+		Key:         "/conf/test_project_key/test/mysql.toml",
+		Value:       []byte("database=\"127.0.0.1:3306\""),
+		ModRevision: 4,
+	})
+	assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+
+	ee.dealETCDPut(&KeyValue{
+		Key:         "/conf/test_project_key/test/mysql.toml",
+		Value:       []byte("PUBLISH&THIS_IS_TOKEN&1&5&SecretData=="),
+		ModRevision: 6,
+	})
+	assert.Equal(t, "10.0.0.5:3306", sail.MustGetString("database"))
+
+	// 找不到指向的版本，保留原来的配置
+	ee.dealETCDPut(&KeyValue{
+		Key:         "/conf/test_project_key/test/mysql.toml",
+		Value:       []byte("PUBLISH&THIS_IS_TOKEN&1&3&SecretData=="),
+		ModRevision: 8,
+	})
+	assert.Equal(t, "10.0.0.5:3306", sail.MustGetString("database"))
+}
+
+// flakyGetSource Get 在 down 时返回错误
+type flakyGetSource struct {
+	*MemorySource
+	down int32
+}
+
+func (f *flakyGetSource) Get(ctx context.Context, key string, revision int64) (*KeyValue, error) {
+	if atomic.LoadInt32(&f.down) == 1 {
+		return nil, errors.New("connection refused")
+	}
+	return f.MemorySource.Get(ctx, key, revision)
+}
+
+func Test_etcdWatcher_retryPublish(t *testing.T) {
+	watchRetryInterval = time.Millisecond
+
+	src := &flakyGetSource{MemorySource: NewMemorySource()}
+	src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+	sail := New(&MetaConfig{
+		LogLevel:   "DEBUG",
+		ProjectKey: "test_project_key",
+		Namespace:  "test",
+		Configs:    "mysql.toml",
+	}, WithSource(src))
+	require.NoError(t, sail.Err())
+	defer sail.Close()
+	require.NoError(t, sail.Pull())
+
+	atomic.StoreInt32(&src.down, 1)
+	draft := src.Put("/conf/test_project_key/test/mysql.toml", "database=\"10.0.0.5:3306\"")
+	src.Put("/conf/test_project_key/test/mysql.toml", fmt.Sprintf("PUBLISH&THIS_IS_TOKEN&1&%d&SecretData==", draft))
+
+	// 读取指向的版本失败，revision 停在 PUBLISH 之前
+	require.Eventually(t, func() bool {
+		return sail.WatchHealth().Restarts > 0
+	}, time.Second, time.Millisecond)
+	health := sail.WatchHealth()
+	assert.Equal(t, draft, health.Revision)
+	assert.ErrorContains(t, health.LastError, "connection refused")
+
+	// 恢复后从 PUBLISH 重新监听并应用
+	atomic.StoreInt32(&src.down, 0)
+	require.Eventually(t, func() bool {
+		return sail.WatchHealth().Revision == draft+1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "10.0.0.5:3306", sail.MustGetString("database"))
+}
+
+func TestSail_resyncDeleted(t *testing.T) {
+	newSail := func(t *testing.T, dir string, opts ...Option) (*Sail, *MemorySource) {
+		src := NewMemorySource()
+		src.Put("/conf/test_project_key/test/mysql.toml", "database=\"127.0.0.1:3306\"")
+		src.Put("/conf/test_project_key/test/app.toml", "name=\"app\"")
+		sail := New(&MetaConfig{
+			LogLevel:       "DEBUG",
+			ProjectKey:     "test_project_key",
+			Namespace:      "test",
+			Configs:        "app.toml,mysql.toml",
+			ConfigFilePath: dir,
+		}, append([]Option{WithSource(src)}, opts...)...)
+		require.NoError(t, sail.Err())
+		t.Cleanup(func() {
+			_ = sail.Close()
+		})
+		require.NoError(t, sail.loadETCDConfig())
+		return sail, src
+	}
+
+	t.Run("Remove", func(t *testing.T) {
+		dir := t.TempDir()
+		var removed []string
+		sail, src := newSail(t, dir, WithOnConfigRemove(func(key string, s *Sail) {
+			removed = append(removed, key)
+		}))
+
+		// 压缩或重连期间删除的配置，全量拉取后按删除处理
+		src.Delete("/conf/test_project_key/test/app.toml")
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Nil(t, sail.GetViperWithName("app.toml"))
+		assert.Equal(t, "127.0.0.1:3306", sail.MustGetString("database"))
+		assert.Equal(t, []string{"/conf/test_project_key/test/app.toml"}, removed)
+		_, err := os.Stat(filepath.Join(dir, "app.toml"))
+		assert.True(t, os.IsNotExist(err))
+
+		// 配置都被删除了，全量拉取不报错
+		src.Delete("/conf/test_project_key/test/mysql.toml")
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Empty(t, sail.ConfigOrigins())
+		assert.Equal(t, []string{"/conf/test_project_key/test/app.toml", "/conf/test_project_key/test/mysql.toml"}, removed)
+	})
+
+	t.Run("Keep", func(t *testing.T) {
+		sail, src := newSail(t, t.TempDir(), WithDeletePolicy(DeletePolicyKeep))
+		src.Delete("/conf/test_project_key/test/app.toml")
+		require.NoError(t, sail.loadETCDConfig())
+		assert.Equal(t, "app", sail.MustGetString("name"))
+	})
+
+	t.Run("FirstPullEmpty", func(t *testing.T) {
+		sail := New(&MetaConfig{
+			LogLevel:   "DEBUG",
+			ProjectKey: "test_project_key",
+			Namespace:  "test",
+			Configs:    "mysql.toml",
+		}, WithSource(NewMemorySource()))
+		require.NoError(t, sail.Err())
+		defer sail.Close()
+		assert.Error(t, sail.loadETCDConfig())
+	})
+}